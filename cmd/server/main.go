@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"project/internal/conf"
+	"project/internal/server"
 
 	"github.com/go-kratos/kratos/v2"
 	"github.com/go-kratos/kratos/v2/config"
@@ -78,7 +79,7 @@ func init() {
 //   - Authorization: Json Web Token
 //
 // DO NOT HARD CODE CONFIG OR DEPENDENCIES
-func newApp(reg registry.Registrar, gs *grpc.Server, hs *http.Server) *kratos.App {
+func newApp(reg registry.Registrar, gs *grpc.Server, hs *http.Server, ps *server.PurgeServer, fs *server.FilterServer) *kratos.App {
 	return kratos.New(
 		kratos.ID(id),           // A service ID should be unique in the global scope
 		kratos.Name(Name),       // A service name should be human-readable and clear enough to ensure maintainability
@@ -88,6 +89,8 @@ func newApp(reg registry.Registrar, gs *grpc.Server, hs *http.Server) *kratos.Ap
 		}),
 		kratos.Server( // The service runs both HTTP and GRPC server simultaneously.
 			gs, hs, // Intro-service calls should utilize GRPC server while the front end uses HTTP server
+			ps, // Purges the projects kept in the trash longer than the retention period
+			fs, // Builds the Bloom filter of the project IDs from the database
 		),
 		kratos.Registrar(reg), // Tell the Kratos to use the client as its registrar
 	)
@@ -124,7 +127,7 @@ func main() {
 	log.SetLogger(NewLogger(bc.Telemetry.Log))
 
 	// Inject dependencies into the service
-	app, cleanup, err := wireApp(bc.Registry, bc.Server, bc.Data, bc.Telemetry)
+	app, cleanup, err := wireApp(bc.Registry, bc.Server, bc.Data, bc.Telemetry, bc.Auth)
 	if err != nil {
 		panic(err)
 	}
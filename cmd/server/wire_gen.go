@@ -25,25 +25,54 @@ import (
 //
 // The following code is not the final production code, it just declares the dependency providers and the
 // injection code is generated in the file `wire_gen.go`, which implements the wiring process.
-func wireApp(registry *conf.Registry, confServer *conf.Server, confData *conf.Data, telemetry *conf.Telemetry) (*kratos.App, func(), error) {
-	registrar := server.NewRegistry(registry)
-	dataData, cleanup, err := data.NewData(confData)
+func wireApp(registry *conf.Registry, confServer *conf.Server, confData *conf.Data, telemetry *conf.Telemetry, auth *conf.Auth) (*kratos.App, func(), error) {
+	client, cleanup, err := server.NewEtcdClient(registry)
 	if err != nil {
 		return nil, nil, err
 	}
-	cache, cleanup2, err := data.NewCache(confData)
+	registrar := server.NewRegistry(client)
+	dataData, cleanup2, err := data.NewData(confData)
 	if err != nil {
 		cleanup()
 		return nil, nil, err
 	}
+	cache, cleanup3, err := data.NewCache(confData)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
 	projectRepository := data.NewProjectRepository(dataData, cache)
-	projectManager := biz.NewProjectManager(projectRepository)
+	membershipRepository := data.NewMembershipRepository(dataData)
+	auditRepository := data.NewAuditRepository(dataData)
+	revisionRepository := data.NewRevisionRepository(dataData)
+	transaction := data.NewTransaction(dataData)
+	idGenerator, cleanup4, err := data.NewIdGenerator(confData, dataData, cache, client)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	projectManager := biz.NewProjectManager(projectRepository, membershipRepository, auditRepository, revisionRepository, transaction, idGenerator)
 	projectService := service.NewProjectService(projectManager)
-	middlewares := server.NewMiddlewares(telemetry)
+	idempotencyRepository := data.NewIdempotencyRepository(cache)
+	middlewares, err := server.NewMiddlewares(telemetry, auth, idempotencyRepository)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
 	grpcServer := server.NewGRPCServer(confServer, projectService, middlewares)
 	httpServer := server.NewHTTPServer(confServer, projectService, middlewares)
-	app := newApp(registrar, grpcServer, httpServer)
+	purgeServer := server.NewPurgeServer(confData, projectManager)
+	filterServer := server.NewFilterServer(confData, projectManager)
+	app := newApp(registrar, grpcServer, httpServer, purgeServer, filterServer)
 	return app, func() {
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 	}, nil
@@ -0,0 +1,196 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+)
+
+type Membership = v1.Membership
+
+// Principal is a user or a group roles are granted to.
+type Principal struct {
+	Type v1.PrincipalType
+	Id   string
+}
+
+// MembershipRepository represents the interface for operating the roles granted on the projects.
+type MembershipRepository interface {
+	// Grant grants the role to the principal of the membership, replacing the role it held on the project if any
+	Grant(ctx context.Context, membership *Membership) (*Membership, error)
+	// Revoke revokes the role held by the principal on the project and reports whether there was one
+	Revoke(ctx context.Context, projectId string, principal Principal) (bool, error)
+	FindByProjects(ctx context.Context, projectIds []string) ([]*Membership, error)
+	FindByPrincipals(ctx context.Context, principals []Principal) ([]*Membership, error)
+}
+
+// visibleRootsKey is the context key under which the roots of the subtrees the caller may see are stored
+type visibleRootsKey struct{}
+
+// VisibleRootsFromContext returns the roots of the subtrees the caller may see, which the repositories restrict
+// their listings and searches to. restricted is false when the caller may see every project.
+func VisibleRootsFromContext(ctx context.Context) (roots []string, restricted bool) {
+	roots, restricted = ctx.Value(visibleRootsKey{}).([]string)
+	return
+}
+
+// restrictedActor returns the actor of the request when its access depends on the roles it was granted.
+// Requests without an actor, which are served while the authentication is disabled or run by the background
+// jobs, and actors holding the admin scope may access every project.
+func restrictedActor(ctx context.Context) (*Actor, bool) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.HasScope(ScopeAdmin) {
+		return nil, false
+	}
+	return actor, true
+}
+
+// rolesOf returns the roles granted to the actor, either directly or through its groups, by project ID.
+func (m *ProjectManager) rolesOf(ctx context.Context, actor *Actor) (map[string]v1.Role, error) {
+	principals := []Principal{{Type: v1.PrincipalType_PRINCIPAL_TYPE_USER, Id: actor.Subject}}
+	for _, group := range actor.Groups {
+		principals = append(principals, Principal{Type: v1.PrincipalType_PRINCIPAL_TYPE_GROUP, Id: group})
+	}
+	memberships, err := m.members.FindByPrincipals(ctx, principals)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]v1.Role, len(memberships))
+	for _, ms := range memberships {
+		if ms.Role > roles[ms.ProjectId] {
+			roles[ms.ProjectId] = ms.Role
+		}
+	}
+	return roles, nil
+}
+
+// authorize checks that the caller holds at least the role on the project, either on the project itself or on
+// any of its ancestors. The project may be soft deleted.
+func (m *ProjectManager) authorize(ctx context.Context, id string, role v1.Role) error {
+	actor, restricted := restrictedActor(ctx)
+	if !restricted {
+		return nil
+	}
+	ancestors, err := m.repo.GetAncestorIds(ctx, id)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+		}
+		return err
+	}
+	roles, err := m.rolesOf(ctx, actor)
+	if err != nil {
+		return err
+	}
+	// Roles are ordered, so the strongest role granted on the ancestors is the effective one
+	granted := v1.Role_ROLE_UNSPECIFIED
+	for _, ancestor := range ancestors {
+		if roles[ancestor] > granted {
+			granted = roles[ancestor]
+		}
+	}
+	if granted < role {
+		return v1.ErrorPermissionDenied("The role %v is required on project %v", role, id)
+	}
+	return nil
+}
+
+// authorizeRoot checks that the caller may create root projects, which is reserved to unrestricted callers since
+// no role can be granted on a project that does not exist yet.
+func (m *ProjectManager) authorizeRoot(ctx context.Context) error {
+	if _, restricted := restrictedActor(ctx); restricted {
+		return v1.ErrorPermissionDenied("The scope %v is required to manage root projects", ScopeAdmin)
+	}
+	return nil
+}
+
+// withVisibility returns a copy of the context restricting the listings and searches of the repositories to the
+// subtrees the caller holds a role on, see [VisibleRootsFromContext].
+func (m *ProjectManager) withVisibility(ctx context.Context) (context.Context, error) {
+	actor, restricted := restrictedActor(ctx)
+	if !restricted {
+		return ctx, nil
+	}
+	roles, err := m.rolesOf(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	// A non-nil slice, since an empty one still restricts the caller to nothing
+	roots := make([]string, 0, len(roles))
+	for id := range roles {
+		roots = append(roots, id)
+	}
+	return context.WithValue(ctx, visibleRootsKey{}, roots), nil
+}
+
+// GrantRole grants the role on the project and all its descendants to the principal of the membership.
+// The caller needs the admin role on the project.
+func (m *ProjectManager) GrantRole(ctx context.Context, membership *Membership) (*Membership, error) {
+	if err := m.authorize(ctx, membership.ProjectId, v1.Role_ROLE_ADMIN); err != nil {
+		return nil, err
+	}
+	if _, err := m.repo.FindById(ctx, membership.ProjectId); err != nil {
+		if ent.IsNotFound(err) {
+			return nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v", membership.ProjectId)
+		}
+		return nil, err
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		membership.GrantedBy = actor.Subject
+	}
+	return m.members.Grant(ctx, membership)
+}
+
+// RevokeRole revokes the role held by the principal on the project. The roles inherited from the ancestors of the
+// project are left untouched. The caller needs the admin role on the project.
+//
+// Revoking a role the principal does not hold succeeds without any change, so that the revocations can be retried,
+// while a project that does not exist, live or soft deleted, fails with the reason PROJECT_NOT_FOUND.
+func (m *ProjectManager) RevokeRole(ctx context.Context, projectId string, principal Principal) error {
+	if err := m.authorize(ctx, projectId, v1.Role_ROLE_ADMIN); err != nil {
+		return err
+	}
+	if _, err := m.findAny(ctx, projectId); err != nil {
+		if ent.IsNotFound(err) {
+			return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", projectId)
+		}
+		return err
+	}
+	_, err := m.members.Revoke(ctx, projectId, principal)
+	return err
+}
+
+// ListEffectivePermissions lists the roles applying to the project, those granted on the project itself and those
+// inherited from its ancestors, from the root of the tree down to the project. When the principal is given, only
+// its own roles are listed. The caller needs the admin role on the project.
+func (m *ProjectManager) ListEffectivePermissions(ctx context.Context, projectId string, principal *Principal) ([]*v1.EffectivePermission, error) {
+	if err := m.authorize(ctx, projectId, v1.Role_ROLE_ADMIN); err != nil {
+		return nil, err
+	}
+	ancestors, err := m.repo.GetAncestorIds(ctx, projectId)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v", projectId)
+		}
+		return nil, err
+	}
+	memberships, err := m.members.FindByProjects(ctx, ancestors)
+	if err != nil {
+		return nil, err
+	}
+
+	byProject := make(map[string][]*Membership, len(ancestors))
+	for _, ms := range memberships {
+		if principal != nil && (ms.PrincipalType != principal.Type || ms.PrincipalId != principal.Id) {
+			continue
+		}
+		byProject[ms.ProjectId] = append(byProject[ms.ProjectId], ms)
+	}
+	permissions := make([]*v1.EffectivePermission, 0, len(memberships))
+	for _, ancestor := range ancestors {
+		for _, ms := range byProject[ancestor] {
+			permissions = append(permissions, &v1.EffectivePermission{Membership: ms, Inherited: ancestor != projectId})
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,59 @@
+package biz
+
+import "context"
+
+// Actor is the authenticated caller on whose behalf a request is served.
+type Actor struct {
+	// Subject identifies the caller, it is the subject of the token of the caller
+	Subject string
+	// Scopes are the permissions granted to the caller by its token
+	Scopes []string
+	// Groups are the groups the caller belongs to, which hold roles on the projects as well
+	Groups []string
+	// Tenant is the tenant the caller belongs to, empty for the default tenant
+	Tenant string
+}
+
+// ScopeAdmin is the scope of the operators of the service, who access every project regardless of the roles
+// granted on them
+const ScopeAdmin = "project:admin"
+
+// actorKey is the context key under which the actor of the request is stored
+type actorKey struct{}
+
+// NewActorContext returns a copy of the context carrying the actor.
+func NewActorContext(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the request, which is absent when the authentication is disabled.
+func ActorFromContext(ctx context.Context) (actor *Actor, ok bool) {
+	actor, ok = ctx.Value(actorKey{}).(*Actor)
+	return
+}
+
+// HasScope reports whether the actor was granted the scope.
+func (a *Actor) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantKey is the context key under which the tenant of the request is stored
+type tenantKey struct{}
+
+// NewTenantContext returns a copy of the context carrying the tenant. The repositories only read and write
+// the data of the tenant carried by the context.
+func NewTenantContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the request, which is the default tenant, namely the empty string,
+// when the context carries none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
@@ -0,0 +1,143 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"time"
+)
+
+type AuditEvent = v1.AuditEvent
+
+// AuditFilter selects the events returned by [ProjectManager.ListAuditEvents]. Zero values leave the corresponding
+// criterion out.
+type AuditFilter struct {
+	ProjectId string
+	// IncludeSubtree extends the events of ProjectId to the projects that were its descendants when they changed
+	IncludeSubtree bool
+	Actor          string
+	StartTime      time.Time
+	EndTime        time.Time
+}
+
+// AuditRepository represents the interface for operating the audit log of the changes made to the projects.
+type AuditRepository interface {
+	// Record writes the event, within the transaction bound to the context if any
+	Record(ctx context.Context, event *AuditEvent) error
+	// List retrieves at most limit events matching the filter, latest first, starting below the event ID before
+	// when it is positive
+	List(ctx context.Context, filter *AuditFilter, before int64, limit int) ([]*AuditEvent, error)
+}
+
+// requestIDKey is the context key under which the ID of the request is stored
+type requestIDKey struct{}
+
+// NewRequestIDContext returns a copy of the context carrying the ID of the request, which the audit events of
+// the changes made by the request refer to.
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the request, empty for the work done by the service itself.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// record writes the audit event of a change made to the project, together with the new revision of the project
+// unless it was purged. It must be called with the context of the transaction making the change, so that the
+// change, its event and the revision are committed together.
+func (m *ProjectManager) record(ctx context.Context, operation v1.AuditOperation, id string, before, after *Project) error {
+	event := &AuditEvent{
+		Operation: operation,
+		ProjectId: id,
+		Before:    before,
+		After:     after,
+		RequestId: RequestIDFromContext(ctx),
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		event.Actor = actor.Subject
+	}
+	if err := m.audit.Record(ctx, event); err != nil {
+		return err
+	}
+	if after == nil {
+		return nil
+	}
+	_, err := m.revisions.Add(ctx, &ProjectRevision{
+		ProjectId: id,
+		Project:   after,
+		Operation: operation,
+		Actor:     event.Actor,
+	})
+	return err
+}
+
+// recordDescendants records the changes made to the descendants of the project by an operation on its whole
+// subtree, such as a cascading delete or a move, given the subtree as it was before the operation.
+//
+// Every change of a project moves its version forward, so the descendants touched by the operation are those whose
+// entity tags changed, and each of them gets an audit event and a revision of its own.
+func (m *ProjectManager) recordDescendants(ctx context.Context, operation v1.AuditOperation, id string, subtree []*Project) error {
+	befores := make(map[string]*Project, len(subtree))
+	ids := make([]string, 0, len(subtree))
+	for _, p := range subtree {
+		if p.ProjectId != id {
+			befores[p.ProjectId] = p
+			ids = append(ids, p.ProjectId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	afters, err := m.repo.FindByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, after := range afters {
+		before := befores[after.ProjectId]
+		if before == nil || before.Etag == after.Etag {
+			continue
+		}
+		if err = m.record(ctx, operation, after.ProjectId, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAuditEvents retrieves one page of the events matching the filter, latest first.
+//
+// Only the events of the projects the caller holds a role on are listed, the roles being those held when the
+// events are listed. The returned token leads to the next page, it is empty once the last page is reached.
+func (m *ProjectManager) ListAuditEvents(ctx context.Context, filter *AuditFilter, pageSize int32, pageToken string) (events []*AuditEvent, nextPageToken string, err error) {
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, "", v1.ErrorMalformedInput("The page size should be between 1 and %v", maxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	var before int64
+	if pageToken != "" {
+		if before, err = decodeSequenceToken(pageToken); err != nil {
+			return nil, "", err
+		}
+	}
+	if filter.ProjectId != "" {
+		if err = m.authorize(ctx, filter.ProjectId, v1.Role_ROLE_VIEWER); err != nil {
+			return nil, "", err
+		}
+	}
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, "", err
+	}
+
+	// One more event than requested tells whether there is a next page
+	if events, err = m.audit.List(ctx, filter, before, int(pageSize)+1); err != nil {
+		return nil, "", err
+	}
+	if len(events) > int(pageSize) {
+		events = events[:pageSize]
+		nextPageToken = encodeSequenceToken(events[len(events)-1].Id)
+	}
+	return events, nextPageToken, nil
+}
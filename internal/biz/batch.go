@@ -0,0 +1,181 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+	"strconv"
+
+	"github.com/go-kratos/kratos/v2/errors"
+)
+
+// BatchResult is the outcome of one item of a batch.
+type BatchResult struct {
+	// Etag is the entity tag of the project once created or updated, empty when it was deleted
+	Etag string
+	// Err is the reason why the item could not be applied, nil on success
+	Err error
+}
+
+// ProjectUpdate is one item of [ProjectManager.BatchUpdate], see [ProjectManager.Update].
+type ProjectUpdate struct {
+	Project *Project
+	Mask    []string
+}
+
+// ProjectDeletion is one item of [ProjectManager.BatchRemove], see [ProjectManager.RemoveById].
+type ProjectDeletion struct {
+	ProjectId string
+	Policy    v1.DeletionPolicy
+	Etag      string
+}
+
+// BatchAdd creates the projects, which may reference parents created by the same batch wherever they appear in
+// it, since parents are always created before their children.
+//
+// An atomic batch creates all the projects or none of them, and fails with the error of the first project that
+// cannot be created, see [batchError]. Otherwise every project is created on its own, and a failure is reported
+// in the result at the same index without affecting the other projects, except for the descendants of the project.
+func (m *ProjectManager) BatchAdd(ctx context.Context, projects []*Project, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(projects))
+	return results, m.inBatch(ctx, atomic, results, func(ctx context.Context) []error {
+		return m.inParentOrder(ctx, projects, atomic, func(ctx context.Context, i int) error {
+			if err := m.Add(ctx, projects[i]); err != nil {
+				return err
+			}
+			created, err := m.repo.FindById(ctx, projects[i].ProjectId)
+			if err != nil {
+				return err
+			}
+			results[i].Etag = created.Etag
+			return nil
+		})
+	})
+}
+
+// BatchUpdate applies the updates in order, an atomic batch applying all of them or none of them,
+// see [ProjectManager.BatchAdd].
+func (m *ProjectManager) BatchUpdate(ctx context.Context, updates []ProjectUpdate, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(updates))
+	return results, m.inBatch(ctx, atomic, results, func(ctx context.Context) []error {
+		return inOrder(len(updates), atomic, func(i int) error {
+			after, err := m.Update(ctx, updates[i].Project, updates[i].Mask)
+			if err != nil {
+				return err
+			}
+			results[i].Etag = after.Etag
+			return nil
+		})
+	})
+}
+
+// BatchRemove applies the deletions in order, an atomic batch applying all of them or none of them,
+// see [ProjectManager.BatchAdd]. A project deleted along with an ancestor by an earlier item cannot be found by a
+// later one.
+func (m *ProjectManager) BatchRemove(ctx context.Context, deletions []ProjectDeletion, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(deletions))
+	return results, m.inBatch(ctx, atomic, results, func(ctx context.Context) []error {
+		return inOrder(len(deletions), atomic, func(i int) error {
+			d := deletions[i]
+			return m.RemoveById(ctx, d.ProjectId, d.Policy, d.Etag)
+		})
+	})
+}
+
+// inBatch runs the items of a batch, within a single transaction for an atomic batch, which is rolled back as soon
+// as an item fails. The errors of the items are stored in their results.
+func (m *ProjectManager) inBatch(ctx context.Context, atomic bool, results []BatchResult, run func(ctx context.Context) []error) error {
+	if !atomic {
+		for i, err := range run(ctx) {
+			results[i].Err = err
+		}
+		return nil
+	}
+	return m.tx.InTx(ctx, func(ctx context.Context) error {
+		return batchError(run(ctx))
+	})
+}
+
+// inOrder calls apply on the items one after the other, and returns the error of each item at its index.
+// With failFast set, the first failure stops the batch.
+func inOrder(n int, failFast bool, apply func(i int) error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		if errs[i] = apply(i); errs[i] != nil && failFast {
+			break
+		}
+	}
+	return errs
+}
+
+// inParentOrder calls apply on the projects, every parent before its children, and returns the error of each
+// project at its index. A project whose parent is neither in the batch nor stored fails with INVALID_PARENT, and so
+// do the projects whose parents form a cycle, while the children of a project that failed cannot find their parent.
+// With failFast set, the first failure stops the batch.
+func (m *ProjectManager) inParentOrder(ctx context.Context, projects []*Project, failFast bool, apply func(ctx context.Context, i int) error) []error {
+	errs := make([]error, len(projects))
+	known := make(map[string]bool)
+	pending := make([]int, 0, len(projects))
+	for i := range projects {
+		pending = append(pending, i)
+	}
+	for len(pending) > 0 {
+		waiting := make(map[string]bool, len(pending))
+		for _, i := range pending {
+			waiting[projects[i].ProjectId] = true
+		}
+
+		var deferred []int
+		for _, i := range pending {
+			p := projects[i]
+			delete(waiting, p.ProjectId)
+			if parent := p.ParentProjId; parent != "" && !known[parent] {
+				if waiting[parent] {
+					deferred = append(deferred, i)
+					continue
+				}
+				if _, err := m.repo.FindById(ctx, parent); err != nil {
+					if ent.IsNotFound(err) {
+						err = v1.ErrorInvalidParent("Cannot find the parent project with id %v", parent)
+					}
+					errs[i] = err
+					if failFast {
+						return errs
+					}
+					continue
+				}
+				known[parent] = true
+			}
+			if errs[i] = apply(ctx, i); errs[i] == nil {
+				known[p.ProjectId] = true
+			} else if failFast {
+				return errs
+			}
+		}
+
+		// Projects still waiting for each other reference their own descendants
+		if len(deferred) == len(pending) {
+			for _, i := range deferred {
+				errs[i] = v1.ErrorInvalidParent("The parent projects of %v form a cycle", projects[i].ProjectId)
+			}
+			break
+		}
+		pending = deferred
+	}
+	return errs
+}
+
+// batchError returns the first error of the items of a batch, with the index of the item in its `index` metadata.
+func batchError(errs []error) error {
+	for i, err := range errs {
+		if err != nil {
+			e := errors.FromError(err)
+			metadata := map[string]string{"index": strconv.Itoa(i)}
+			for k, v := range e.Metadata {
+				metadata[k] = v
+			}
+			return e.WithMetadata(metadata)
+		}
+	}
+	return nil
+}
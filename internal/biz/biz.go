@@ -9,9 +9,21 @@
 //   - Repository is responsible for retrieving and storing aggregates.
 package biz
 
-import "github.com/google/wire"
+import (
+	"context"
+
+	"github.com/google/wire"
+)
 
 // ProviderSet is biz providers.
 var ProviderSet = wire.NewSet(
 	NewProjectManager,
 )
+
+// Transaction runs several repository calls atomically.
+//
+// The repositories pick the transaction up from the context passed to fn, so fn must hand that context over
+// to every call that belongs to the transaction. Nested calls join the outermost transaction.
+type Transaction interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
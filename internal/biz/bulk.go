@@ -0,0 +1,315 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+)
+
+// importChunkSize is the number of projects a bulk import writes at once
+const importChunkSize = 500
+
+// ImportProgress counts the projects of a bulk import by outcome.
+type ImportProgress struct {
+	Received int64
+	Created  int64
+	Updated  int64
+	// Skipped counts the projects already written by an earlier run of the same import
+	Skipped int64
+	Failed  int64
+	// Waiting counts the projects whose parents have not arrived yet
+	Waiting int64
+}
+
+// ImportFailure reports a project of a bulk import that could not be imported.
+type ImportFailure struct {
+	// Index is the position of the project in the stream
+	Index     int64
+	ProjectId string
+	Err       error
+}
+
+// importItem is a project of a bulk import together with its position in the stream.
+type importItem struct {
+	index   int64
+	project *Project
+}
+
+// BulkImport imports a stream of projects by chunks, see [ProjectManager.NewBulkImport].
+type BulkImport struct {
+	m  *ProjectManager
+	id string
+	// ready holds the projects whose parents are stored or may be stored, to be written with the next chunk
+	ready []importItem
+	// waiting holds the projects whose parents are not stored, by the ID of their parents
+	waiting map[string][]importItem
+	// live tells the IDs of the projects known to be stored and live
+	live     map[string]bool
+	progress ImportProgress
+}
+
+// NewBulkImport starts importing a stream of projects under the import ID, which is reserved to the callers who may
+// manage the root projects.
+//
+// Projects are created when they do not exist yet, otherwise they are updated and moved under their parents like
+// [ProjectManager.Import] does. The projects to create are written by chunks, each of them in a single statement.
+// A project may arrive before its parent, it is then held back until its parent arrives.
+//
+// The projects written by the import are marked with its ID, so that importing the same stream again under the same
+// ID skips them. An interrupted import is thus resumed by sending the whole stream again, without overwriting the
+// changes made to the projects it already wrote since.
+func (m *ProjectManager) NewBulkImport(ctx context.Context, importId string) (*BulkImport, error) {
+	if importId == "" {
+		return nil, v1.ErrorMalformedInput("The ID of the import is required")
+	}
+	if err := m.authorizeRoot(ctx); err != nil {
+		return nil, err
+	}
+	return &BulkImport{
+		m:       m,
+		id:      importId,
+		waiting: make(map[string][]importItem),
+		live:    make(map[string]bool),
+	}, nil
+}
+
+// Progress returns the counts of the projects processed so far.
+func (b *BulkImport) Progress() ImportProgress {
+	return b.progress
+}
+
+// Add queues the project found at the index of the stream, and writes the queued projects once they fill a chunk.
+// It returns whether a chunk was written together with the projects of the chunk that could not be imported.
+// An error is only returned when the import cannot go on, such as when the database is unavailable.
+func (b *BulkImport) Add(ctx context.Context, index int64, project *Project) (flushed bool, failures []ImportFailure, err error) {
+	b.progress.Received++
+	b.ready = append(b.ready, importItem{index: index, project: project})
+	if len(b.ready) < importChunkSize {
+		return false, nil, nil
+	}
+	failures, err = b.flush(ctx)
+	return true, failures, err
+}
+
+// Reject counts the project found at the index of the stream as failed without importing it.
+func (b *BulkImport) Reject(index int64, projectId string, err error) ImportFailure {
+	b.progress.Received++
+	b.progress.Failed++
+	return ImportFailure{Index: index, ProjectId: projectId, Err: err}
+}
+
+// Close writes the projects left once the stream has ended. The projects still waiting for their parents then fail,
+// since their parents are neither stored nor part of the stream.
+func (b *BulkImport) Close(ctx context.Context) ([]ImportFailure, error) {
+	var failures []ImportFailure
+	// Writing a chunk may release the children of its projects, which make another chunk
+	for len(b.ready) > 0 {
+		chunk, err := b.flush(ctx)
+		failures = append(failures, chunk...)
+		if err != nil {
+			return failures, err
+		}
+	}
+	for parent, items := range b.waiting {
+		for _, item := range items {
+			failures = append(failures, b.fail(item, v1.ErrorInvalidParent("Cannot find the parent project with id %v", parent)))
+		}
+	}
+	b.waiting = make(map[string][]importItem)
+	b.progress.Waiting = 0
+	return failures, nil
+}
+
+// fail counts the project as failed and reports why.
+func (b *BulkImport) fail(item importItem, err error) ImportFailure {
+	b.progress.Failed++
+	return ImportFailure{Index: item.index, ProjectId: item.project.ProjectId, Err: err}
+}
+
+// flush writes the ready projects whose parents are stored or part of the chunk, the others wait for their parents.
+// The projects to create are written in a single transaction, while the projects to update are written one by one.
+// Their boundaries are checked first, like [ProjectManager.Add] does, so that an invalid project fails alone.
+func (b *BulkImport) flush(ctx context.Context) (failures []ImportFailure, err error) {
+	chunk := b.ready
+	b.ready = nil
+
+	// Look the projects and their parents up at once
+	ids := make([]string, 0, 2*len(chunk))
+	for _, item := range chunk {
+		ids = append(ids, item.project.ProjectId)
+		if parent := item.project.ParentProjId; parent != "" && !b.live[parent] {
+			ids = append(ids, parent)
+		}
+	}
+	found, err := b.m.repo.FindByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]*Project, len(found))
+	for _, p := range found {
+		stored[p.ProjectId] = p
+		if p.DeleteTime == nil {
+			b.live[p.ProjectId] = true
+		}
+	}
+	imported, err := b.m.repo.FindImportedIds(ctx, b.id, ids)
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[string]bool, len(imported))
+	for _, id := range imported {
+		skipped[id] = true
+	}
+
+	// Parents come before their children, the projects whose parents are missing wait for them
+	var creates, updates []importItem
+	inChunk := make(map[string]bool, len(chunk))
+	for _, item := range chunk {
+		inChunk[item.project.ProjectId] = true
+	}
+	accepted := make(map[string]bool, len(chunk))
+	pending := chunk
+	for len(pending) > 0 {
+		var deferred []importItem
+		for _, item := range pending {
+			p := item.project
+			if parent := p.ParentProjId; parent != "" && !b.live[parent] && !accepted[parent] {
+				if inChunk[parent] {
+					deferred = append(deferred, item)
+				} else {
+					b.waiting[parent] = append(b.waiting[parent], item)
+					b.progress.Waiting++
+				}
+				continue
+			}
+			if err := validateBoundary(p.Boundary); err != nil && !skipped[p.ProjectId] {
+				failures = append(failures, b.fail(item, err))
+				continue
+			}
+			existing, ok := stored[p.ProjectId]
+			switch {
+			case skipped[p.ProjectId]:
+				b.progress.Skipped++
+				if existing.DeleteTime == nil {
+					b.release(p.ProjectId)
+				}
+				continue
+			case accepted[p.ProjectId]:
+				failures = append(failures, b.fail(item, v1.ErrorMalformedInput("The project %v appears twice in the import", p.ProjectId)))
+				continue
+			case !ok:
+				creates = append(creates, item)
+			case existing.DeleteTime != nil:
+				failures = append(failures, b.fail(item, v1.ErrorConflict("The project %v is in the trash, restore or purge it before importing it", p.ProjectId)))
+				continue
+			default:
+				updates = append(updates, item)
+			}
+			accepted[p.ProjectId] = true
+		}
+		// Projects still waiting for each other within the chunk wait for a parent outside of it
+		if len(deferred) == len(pending) {
+			for _, item := range deferred {
+				b.waiting[item.project.ParentProjId] = append(b.waiting[item.project.ParentProjId], item)
+				b.progress.Waiting++
+			}
+			break
+		}
+		pending = deferred
+	}
+
+	if len(creates) > 0 {
+		failures = append(failures, b.create(ctx, creates)...)
+	}
+	for _, item := range updates {
+		if err := b.update(ctx, item.project, stored[item.project.ProjectId]); err != nil {
+			failures = append(failures, b.fail(item, err))
+			continue
+		}
+		b.progress.Updated++
+		b.live[item.project.ProjectId] = true
+		b.release(item.project.ProjectId)
+	}
+	return failures, nil
+}
+
+// create writes the new projects of a chunk and returns the projects that could not be written.
+//
+// The chunk is written in a single statement, which fails as a whole when any of its projects is refused by the
+// database. Its projects are then written again one at a time, so that only the faulty ones fail, together with
+// their children in the chunk which cannot find their parents anymore.
+func (b *BulkImport) create(ctx context.Context, items []importItem) (failures []ImportFailure) {
+	err := b.insert(ctx, items)
+	if err == nil {
+		return nil
+	}
+	if len(items) == 1 {
+		return []ImportFailure{b.fail(items[0], err)}
+	}
+	for _, item := range items {
+		if err = b.insert(ctx, []importItem{item}); err != nil {
+			failures = append(failures, b.fail(item, err))
+		}
+	}
+	return failures
+}
+
+// insert writes the new projects together with their audit events and revisions, all of them or none.
+func (b *BulkImport) insert(ctx context.Context, items []importItem) error {
+	projects := make([]*Project, 0, len(items))
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		projects = append(projects, item.project)
+		ids = append(ids, item.project.ProjectId)
+	}
+	err := b.m.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := b.m.repo.AddBulk(ctx, projects, b.id); err != nil {
+			return err
+		}
+		created, err := b.m.repo.FindByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, after := range created {
+			if err = b.m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_CREATE, after.ProjectId, nil, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.progress.Created += int64(len(items))
+	for _, id := range ids {
+		b.live[id] = true
+		b.release(id)
+	}
+	return nil
+}
+
+// update writes a project that already exists, moving it under its new parent if need be, and marks it as written
+// by the import. The update, the move and the mark are applied together or not at all.
+func (b *BulkImport) update(ctx context.Context, project *Project, existing *Project) error {
+	// An import overwrites the existing project, whichever version the imported one was exported from
+	project.Etag = ""
+	return b.m.tx.InTx(ctx, func(ctx context.Context) error {
+		if _, err := b.m.Update(ctx, project, nil); err != nil {
+			return err
+		}
+		if existing.ParentProjId != project.ParentProjId {
+			if err := b.m.Move(ctx, project.ProjectId, project.ParentProjId); err != nil {
+				return err
+			}
+		}
+		return b.m.repo.MarkImported(ctx, b.id, []string{project.ProjectId})
+	})
+}
+
+// release makes the projects waiting for the parent ready to be written with the next chunk.
+func (b *BulkImport) release(parent string) {
+	if items, ok := b.waiting[parent]; ok {
+		delete(b.waiting, parent)
+		b.progress.Waiting -= int64(len(items))
+		b.ready = append(b.ready, items...)
+	}
+}
@@ -0,0 +1,38 @@
+package biz
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyClaimTTL bounds how long a key stays claimed by a request that stopped extending its claim, so that the
+// key is freed even if the server stops before the request completes. A running request extends its claim well
+// before it expires, however long it runs.
+const IdempotencyClaimTTL = time.Minute
+
+// IdempotencyRecord is what is remembered of a request carrying an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the operation and the payload of the request
+	Fingerprint string
+	// Reply is the encoded reply of the request, nil while the request is still running
+	Reply []byte
+}
+
+// IdempotencyRepository remembers the replies of the requests carrying idempotency keys, so that the retries of
+// a request are answered with its first reply instead of being applied again. The keys are scoped by the tenant
+// of the request.
+//
+// A request claims the key while it runs. The claim expires after [IdempotencyClaimTTL] unless it is extended, and
+// once it has expired, the key may be claimed by a retry, so the request that lost its claim can neither complete
+// nor release the key anymore.
+type IdempotencyRepository interface {
+	// Reserve claims the key for the request with the fingerprint. It returns the claim of the request once the key
+	// is claimed, or the record of the request that claimed the key first.
+	Reserve(ctx context.Context, key, fingerprint string) (claim string, record *IdempotencyRecord, err error)
+	// Extend keeps the key claimed for another [IdempotencyClaimTTL], it fails once the claim has been lost
+	Extend(ctx context.Context, key, claim string) error
+	// Complete stores the reply of the request holding the claim, which is then kept for the configured window
+	Complete(ctx context.Context, key, claim string, record *IdempotencyRecord) error
+	// Release frees the key claimed by a request that failed, so that its retries are applied again
+	Release(ctx context.Context, key, claim string) error
+}
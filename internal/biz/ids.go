@@ -0,0 +1,38 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+)
+
+// maxIdAttempts is the number of generated IDs tried before giving up, since an ID derived from a sequence may
+// already be taken by a project whose ID was chosen by its caller
+const maxIdAttempts = 5
+
+// IdGenerator generates the IDs of the projects created without one, see [ProjectManager.Add].
+type IdGenerator interface {
+	// NewId returns a new ID for the project, which may be derived from its parent
+	NewId(ctx context.Context, project *Project) (string, error)
+}
+
+// assignId sets a generated ID on a project created without one, skipping the IDs already taken.
+func (m *ProjectManager) assignId(ctx context.Context, project *Project) error {
+	if project.ProjectId != "" {
+		return nil
+	}
+	for attempt := 0; attempt < maxIdAttempts; attempt++ {
+		id, err := m.ids.NewId(ctx, project)
+		if err != nil {
+			return err
+		}
+		exists, err := m.repo.IsProjectIDExist(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			project.ProjectId = id
+			return nil
+		}
+	}
+	return v1.ErrorConflict("Cannot generate an unused project ID, retry or choose the ID")
+}
@@ -0,0 +1,179 @@
+package biz
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of the project listing
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// ListProjectsFilter selects and orders the projects returned by [ProjectManager.ListProjects].
+// Zero values leave the corresponding criterion out.
+type ListProjectsFilter struct {
+	// SubtreeRootId restricts the listing to the project and its descendants, down to MaxDepth levels below it
+	// unless MaxDepth is 0
+	SubtreeRootId    string
+	MaxDepth         int32
+	ParentProjId     string
+	LocationContains string
+	CreateAfter      time.Time
+	CreateBefore     time.Time
+	UpdateAfter      time.Time
+	UpdateBefore     time.Time
+	Deleted          v1.DeletedFilter
+	OrderBy          v1.ListOrder
+	Descending       bool
+}
+
+// ProjectCursor is the position right after the last project of a page. The projects of the next page follow
+// it in the order of the listing, which is the order of the sort key and then of the project ID.
+type ProjectCursor struct {
+	// OrderBy and Descending record the order the cursor was made for, it cannot serve another order
+	OrderBy    v1.ListOrder `json:"o,omitempty"`
+	Descending bool         `json:"d,omitempty"`
+	// Time is the sort key of the last project when ordering by a timestamp
+	Time time.Time `json:"t,omitempty"`
+	// ProjectId is the ID of the last project
+	ProjectId string `json:"i"`
+}
+
+// newProjectCursor returns the cursor positioned right after the project.
+func newProjectCursor(filter *ListProjectsFilter, last *Project) *ProjectCursor {
+	cursor := &ProjectCursor{OrderBy: filter.OrderBy, Descending: filter.Descending, ProjectId: last.ProjectId}
+	switch filter.OrderBy {
+	case v1.ListOrder_LIST_ORDER_CREATE_TIME:
+		cursor.Time = last.CreateTime.AsTime()
+	case v1.ListOrder_LIST_ORDER_LAST_UPDATE:
+		cursor.Time = last.LastUpdate.AsTime()
+	}
+	return cursor
+}
+
+// encode returns the opaque page token carrying the cursor.
+func (c *ProjectCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeProjectCursor parses a page token returned by a previous call for the same order.
+func decodeProjectCursor(token string, filter *ListProjectsFilter) (*ProjectCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, v1.ErrorMalformedInput("Malformed page token")
+	}
+	var cursor ProjectCursor
+	if err = json.Unmarshal(raw, &cursor); err != nil || cursor.ProjectId == "" {
+		return nil, v1.ErrorMalformedInput("Malformed page token")
+	}
+	if cursor.OrderBy != filter.OrderBy || cursor.Descending != filter.Descending {
+		return nil, v1.ErrorMalformedInput("The page token was issued for another order")
+	}
+	return &cursor, nil
+}
+
+// encodeSequenceToken returns the page token of a listing ordered by a decreasing sequence number, such as the
+// IDs of the audit events or the revision numbers, whose next page starts below the number.
+func encodeSequenceToken(n int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(n, 10)))
+}
+
+// decodeSequenceToken parses a page token returned by [encodeSequenceToken].
+func decodeSequenceToken(token string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, v1.ErrorMalformedInput("Malformed page token")
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, v1.ErrorMalformedInput("Malformed page token")
+	}
+	return n, nil
+}
+
+// ListProjects retrieves one page of the projects matching the filter.
+//
+// Pages are delimited by cursors rather than offsets, so projects created or removed meanwhile never shift the
+// following pages. The returned token leads to the next page, it is empty once the last page is reached.
+// Only the projects the caller holds a role on are listed.
+func (m *ProjectManager) ListProjects(ctx context.Context, filter *ListProjectsFilter, pageSize int32, pageToken string) (projects []*Project, nextPageToken string, err error) {
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, "", v1.ErrorMalformedInput("The page size should be between 1 and %v", maxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	var cursor *ProjectCursor
+	if pageToken != "" {
+		if cursor, err = decodeProjectCursor(pageToken, filter); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, "", err
+	}
+	// One more project than requested tells whether there is a next page
+	if projects, err = m.repo.ListProjects(ctx, filter, cursor, int(pageSize)+1); err != nil {
+		return nil, "", err
+	}
+	if len(projects) > int(pageSize) {
+		projects = projects[:pageSize]
+		nextPageToken = newProjectCursor(filter, projects[len(projects)-1]).encode()
+	}
+	return projects, nextPageToken, nil
+}
+
+// ExportedProject is a project listed by [ProjectManager.Export] together with its path.
+type ExportedProject = v1.ExportedProject
+
+// Export calls emit for every project matching the filter, in the order of the listing. The projects are read one
+// page at a time, so that a large export is never held in memory, and the export stops at the first error returned
+// by emit. Only the projects the caller holds a role on are exported.
+func (m *ProjectManager) Export(ctx context.Context, filter *ListProjectsFilter, emit func(*ExportedProject) error) error {
+	if filter.SubtreeRootId != "" {
+		if err := m.authorize(ctx, filter.SubtreeRootId, v1.Role_ROLE_VIEWER); err != nil {
+			return err
+		}
+		if _, err := m.findAny(ctx, filter.SubtreeRootId); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", filter.SubtreeRootId)
+			}
+			return err
+		}
+	}
+	var pageToken string
+	for {
+		projects, nextPageToken, err := m.ListProjects(ctx, filter, maxPageSize, pageToken)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(projects))
+		for _, p := range projects {
+			ids = append(ids, p.ProjectId)
+		}
+		// The paths of a whole page are read at once rather than walking up the ancestors of every project
+		paths, err := m.repo.GetAncestorIdsByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, p := range projects {
+			if err = emit(&ExportedProject{Project: p, Path: strings.Join(paths[p.ProjectId], "/")}); err != nil {
+				return err
+			}
+		}
+		if nextPageToken == "" {
+			return nil
+		}
+		pageToken = nextPageToken
+	}
+}
@@ -4,6 +4,12 @@ import (
 	"context"
 	v1 "project/api/project/v1"
 	"project/internal/ent"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type Project = v1.Project
@@ -11,62 +17,712 @@ type Project = v1.Project
 // ProjectRepository represents the interface for operating project entities stored in the database.
 type ProjectRepository interface {
 	Add(ctx context.Context, project *Project) error
-	Remove(ctx context.Context, project *Project) error
-	Update(ctx context.Context, project *Project) error
+	Remove(ctx context.Context, project *Project, group string) error
+	RemoveSubtree(ctx context.Context, project *Project, group string) error
+	FindChildIds(ctx context.Context, id string) ([]string, error)
+	// Update changes the given fields of the project, named as in the protocol buffers, see [updatableFields]
+	Update(ctx context.Context, project *Project, fields []string) error
 	FindById(ctx context.Context, id string) (*Project, error)
 	FindByName(ctx context.Context, name string) (*Project, error)
 	RecoverById(ctx context.Context, id string) error
 	IsProjectIDExist(ctx context.Context, projectID string) (bool, error)
+	RebuildProjectFilter(ctx context.Context) (int, error)
 	GetProjectPath(ctx context.Context, projectId string) ([]*Project, error)
-	FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*v1.Project, error)
+	FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*v1.NearbyProject, error)
+	GetProjectSubtree(ctx context.Context, projectId string, maxDepth int) ([]*Project, error)
+	Move(ctx context.Context, projectId string, newParentId string) error
+	IsDescendantOf(ctx context.Context, projectId string, ancestorId string) (bool, error)
+	FindNearestProjects(ctx context.Context, location *v1.GeoPoint, k int, rootId string) ([]*v1.NearbyProject, error)
+	FindProjectsInBounds(ctx context.Context, southWest, northEast *v1.GeoPoint, rootId string) ([]*Project, error)
+	FindProjectsInPolygon(ctx context.Context, polygon *v1.GeoPolygon, rootId string) ([]*Project, error)
+	FindProjectsContainingPoint(ctx context.Context, location *v1.GeoPoint, rootId string) ([]*Project, error)
+	ListProjects(ctx context.Context, filter *ListProjectsFilter, after *ProjectCursor, limit int) ([]*Project, error)
+	FindDeletedById(ctx context.Context, id string) (*Project, error)
+	HasLiveDescendants(ctx context.Context, id string) (bool, error)
+	// HasDescendantsDeletedSince reports whether any strict descendant of the project was soft deleted at or after
+	// the time
+	HasDescendantsDeletedSince(ctx context.Context, id string, since time.Time) (bool, error)
+	// Purge hard deletes the soft deleted project and its soft deleted descendants, only the ones deleted before
+	// deletedBefore unless it is zero
+	Purge(ctx context.Context, id string, deletedBefore time.Time) error
+	FindExpiredIds(ctx context.Context, cutoff time.Time, limit int) ([]string, error)
+	FindTenantsInTrash(ctx context.Context) ([]string, error)
+	// GetAncestorIds returns the IDs on the path of the project, live or deleted, from the root down to the project
+	GetAncestorIds(ctx context.Context, id string) ([]string, error)
+	// GetAncestorIdsByIds returns the IDs on the paths of the projects, live or deleted, by the IDs of the projects
+	GetAncestorIdsByIds(ctx context.Context, ids []string) (map[string][]string, error)
+	// AddBulk creates the projects at once, marked as written by the bulk import, parents coming before children
+	AddBulk(ctx context.Context, projects []*Project, importId string) error
+	// FindByIds retrieves the projects with the IDs, live or deleted, in no particular order
+	FindByIds(ctx context.Context, ids []string) ([]*Project, error)
+	// FindSubtree retrieves the project and all of its descendants, live or deleted, in no particular order
+	FindSubtree(ctx context.Context, id string) ([]*Project, error)
+	// FindImportedIds returns the IDs among the given ones of the projects last written by the bulk import
+	FindImportedIds(ctx context.Context, importId string, ids []string) ([]string, error)
+	MarkImported(ctx context.Context, importId string, ids []string) error
 }
 
+// maxNearestProjects is the maximum number of projects that a nearest neighbour query may ask for
+const maxNearestProjects = 1000
+
+// ProjectManager gathers the operations on the projects.
+//
+// Every operation checks the roles of the caller on the projects it touches, see [ProjectManager.authorize].
+// A role granted on a project applies to all its descendants, and the listings and searches only return the
+// projects the caller holds a role on.
+//
+// Every change is recorded in the audit log and in the revision history by the transaction making it,
+// see [ProjectManager.record].
 type ProjectManager struct {
-	repo ProjectRepository
+	repo      ProjectRepository
+	members   MembershipRepository
+	audit     AuditRepository
+	revisions RevisionRepository
+	tx        Transaction
+	ids       IdGenerator
 }
 
-func NewProjectManager(repo ProjectRepository) *ProjectManager {
-	return &ProjectManager{repo: repo}
+func NewProjectManager(repo ProjectRepository, members MembershipRepository, audit AuditRepository, revisions RevisionRepository, tx Transaction, ids IdGenerator) *ProjectManager {
+	return &ProjectManager{repo: repo, members: members, audit: audit, revisions: revisions, tx: tx, ids: ids}
 }
 
-func (m *ProjectManager) Add(ctx context.Context, project *Project) error {
+func (m *ProjectManager) Add(ctx context.Context, project *Project) (err error) {
+	// Creating a project edits the subtree of its parent
+	if project.ParentProjId == "" {
+		err = m.authorizeRoot(ctx)
+	} else {
+		err = m.authorize(ctx, project.ParentProjId, v1.Role_ROLE_EDITOR)
+	}
+	if err != nil {
+		return err
+	}
 	// may be you need to validate the project before adding it,then you can add it
-	return m.repo.Add(ctx, project)
+	if err = validateBoundary(project.Boundary); err != nil {
+		return err
+	}
+	// A project created without an ID gets a generated one, which the caller reads back from the project
+	if err = m.assignId(ctx, project); err != nil {
+		return err
+	}
+	return m.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := m.repo.Add(ctx, project); err != nil {
+			return err
+		}
+		after, err := m.repo.FindById(ctx, project.ProjectId)
+		if err != nil {
+			return err
+		}
+		return m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_CREATE, project.ProjectId, nil, after)
+	})
+}
+
+// RemoveById soft deletes the project, the policy deciding what becomes of its live descendants:
+//
+//   - DELETION_POLICY_REJECT refuses to delete a project that still has live descendants.
+//   - DELETION_POLICY_CASCADE deletes the live descendants along with the project.
+//   - DELETION_POLICY_REPARENT moves the live children of the project, with their subtrees, under its parent.
+//     The caller then needs the editor role on the parent as well, or to manage the root projects when the
+//     children become roots.
+//
+// The projects deleted at once share a delete group so that restoring the project brings them all back.
+// Everything runs in a single transaction, hence a failure leaves the subtree untouched. The audit log and the
+// revision history record the deletion of the project, together with the deletion of every descendant deleted
+// along with it, or the moves of the descendants when the children are re-parented.
+//
+// A non-empty etag is the entity tag of the project the caller last read, the project is then only deleted
+// if it has not changed since, otherwise the delete fails with the reason CONFLICT.
+func (m *ProjectManager) RemoveById(ctx context.Context, id string, policy v1.DeletionPolicy, etag string) error {
+	if err := m.authorize(ctx, id, v1.Role_ROLE_EDITOR); err != nil {
+		return err
+	}
+	return m.tx.InTx(ctx, func(ctx context.Context) (err error) {
+		var proj *Project
+		if proj, err = m.repo.FindById(ctx, id); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+			}
+			return err
+		}
+		group := uuid.NewString()
+		target := proto.Clone(proj).(*Project)
+		target.Etag = etag
+
+		switch policy {
+		case v1.DeletionPolicy_DELETION_POLICY_CASCADE:
+			var subtree []*Project
+			if subtree, err = m.repo.FindSubtree(ctx, id); err != nil {
+				return err
+			}
+			if err = m.repo.RemoveSubtree(ctx, target, group); err != nil {
+				return err
+			}
+			err = m.recordDescendants(ctx, v1.AuditOperation_AUDIT_OPERATION_DELETE, id, subtree)
+		case v1.DeletionPolicy_DELETION_POLICY_REPARENT:
+			var children []string
+			if children, err = m.repo.FindChildIds(ctx, id); err != nil {
+				return err
+			}
+			// The children join the subtree of the grandparent, which the caller has to be allowed to edit like
+			// for any move, or become roots when there is no grandparent
+			if len(children) > 0 {
+				if proj.ParentProjId == "" {
+					err = m.authorizeRoot(ctx)
+				} else {
+					err = m.authorize(ctx, proj.ParentProjId, v1.Role_ROLE_EDITOR)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			// The grandparent is already an ancestor of the children, so the moves cannot create a cycle
+			for _, childId := range children {
+				var child *Project
+				if child, err = m.repo.FindById(ctx, childId); err != nil {
+					return err
+				}
+				if err = m.move(ctx, child, proj.ParentProjId); err != nil {
+					return err
+				}
+			}
+			err = m.repo.Remove(ctx, target, group)
+		default:
+			var alive bool
+			if alive, err = m.repo.HasLiveDescendants(ctx, id); err != nil {
+				return err
+			}
+			if alive {
+				return v1.ErrorHasChildren("Cannot delete project %v while it has live descendants", id)
+			}
+			err = m.repo.Remove(ctx, target, group)
+		}
+		if err != nil {
+			return err
+		}
+		var after *Project
+		if after, err = m.repo.FindDeletedById(ctx, id); err != nil {
+			return err
+		}
+		return m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_DELETE, id, proj, after)
+	})
+}
+
+// Update modifies the fields of the project named by the mask among its description, location, coordinate and
+// boundary, and returns it once updated. An empty mask updates all of them, while the other fields of the
+// project are left untouched.
+//
+// When the project carries an entity tag, it is only updated if it has not changed since the tag was issued,
+// otherwise the update fails with the reason CONFLICT. A project in the trash is not found, it has to be restored
+// before it is changed.
+func (m *ProjectManager) Update(ctx context.Context, project *Project, mask []string) (after *Project, err error) {
+	fields, err := resolveUpdateMask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.authorize(ctx, project.ProjectId, v1.Role_ROLE_EDITOR); err != nil {
+		return nil, err
+	}
+	if slices.Contains(fields, "boundary") {
+		if err = validateBoundary(project.Boundary); err != nil {
+			return nil, err
+		}
+	}
+	err = m.tx.InTx(ctx, func(ctx context.Context) error {
+		before, err := m.repo.FindById(ctx, project.ProjectId)
+		if err != nil {
+			return err
+		}
+		if err = m.repo.Update(ctx, project, fields); err != nil {
+			return err
+		}
+		if after, err = m.repo.FindById(ctx, project.ProjectId); err != nil {
+			return err
+		}
+		return m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_UPDATE, project.ProjectId, before, after)
+	})
+	if ent.IsNotFound(err) {
+		return nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v", project.ProjectId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// updatableFields are the fields of a project that an update may change, named as in the protocol buffers.
+// The other fields are either computed by the service or changed by their own operations, like the parent by a move.
+var updatableFields = []string{"desc", "location", "coordinate", "boundary"}
+
+// resolveUpdateMask returns the fields that an update with the paths of the field mask changes.
+// An empty mask, like the wildcard `*`, stands for all the updatable fields.
+func resolveUpdateMask(paths []string) ([]string, error) {
+	if len(paths) == 0 || slices.Contains(paths, "*") {
+		return updatableFields, nil
+	}
+	fields := make([]string, 0, len(paths))
+	for _, path := range paths {
+		switch {
+		case slices.Contains(updatableFields, path):
+			if !slices.Contains(fields, path) {
+				fields = append(fields, path)
+			}
+		case (&Project{}).ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(path)) != nil:
+			return nil, v1.ErrorMalformedInput("The field %v of a project cannot be updated", path)
+		default:
+			return nil, v1.ErrorMalformedInput("Unknown field %v in the update mask", path)
+		}
+	}
+	return fields, nil
+}
+
+// findAny retrieves the project by its ID, whether it is soft deleted or not.
+func (m *ProjectManager) findAny(ctx context.Context, id string) (*Project, error) {
+	proj, err := m.repo.FindById(ctx, id)
+	if ent.IsNotFound(err) {
+		return m.repo.FindDeletedById(ctx, id)
+	}
+	return proj, err
+}
+
+// Move re-parents the project, carrying its whole subtree along, under the project newParentId.
+//
+// An empty newParentId turns the project into a root. The move is refused with the reason INVALID_PARENT
+// when the new parent does not exist or when it lies inside the subtree being moved, which would create a cycle.
+// The caller needs the editor role on both the project and its new parent.
+//
+// The checks run in the transaction of the move, whose repository locks the project and its new parent, so that
+// concurrent moves cannot create a cycle between the checks and the writes.
+func (m *ProjectManager) Move(ctx context.Context, id string, newParentId string) (err error) {
+	if err = m.authorize(ctx, id, v1.Role_ROLE_EDITOR); err != nil {
+		return err
+	}
+	return m.tx.InTx(ctx, func(ctx context.Context) (err error) {
+		var proj *Project
+		if proj, err = m.repo.FindById(ctx, id); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+			}
+			return err
+		}
+		if proj.ParentProjId == newParentId {
+			return nil
+		}
+		if err = m.checkMove(ctx, id, newParentId); err != nil {
+			return err
+		}
+		return m.move(ctx, proj, newParentId)
+	})
 }
 
-func (m *ProjectManager) RemoveById(ctx context.Context, id string) (err error) {
-	var proj *Project
-	if proj, err = m.repo.FindById(ctx, id); err != nil {
+// checkMove checks that the project may be moved under the project newParentId, see [ProjectManager.Move].
+func (m *ProjectManager) checkMove(ctx context.Context, id string, newParentId string) (err error) {
+	if newParentId == id {
+		return v1.ErrorInvalidParent("Cannot move project %v under itself", id)
+	}
+	if newParentId == "" {
+		return m.authorizeRoot(ctx)
+	}
+	if _, err = m.repo.FindById(ctx, newParentId); err != nil {
 		if ent.IsNotFound(err) {
-			return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+			return v1.ErrorInvalidParent("Cannot find the new parent project with id %v", newParentId)
 		}
 		return err
 	}
-	return m.repo.Remove(ctx, proj)
+	if err = m.authorize(ctx, newParentId, v1.Role_ROLE_EDITOR); err != nil {
+		return err
+	}
+	var cyclic bool
+	// The new parent must not be any of the descendants of the project
+	if cyclic, err = m.repo.IsDescendantOf(ctx, newParentId, id); err != nil {
+		return err
+	}
+	if cyclic {
+		return v1.ErrorInvalidParent("Cannot move project %v under its own descendant %v", id, newParentId)
+	}
+	return nil
 }
 
-func (m *ProjectManager) Update(ctx context.Context, project *Project) (err error) {
-	return m.repo.Update(ctx, project)
+// move re-parents the project and records the move in the audit log, together with the moves of its descendants
+// whose paths and depths change along.
+func (m *ProjectManager) move(ctx context.Context, before *Project, newParentId string) error {
+	subtree, err := m.repo.FindSubtree(ctx, before.ProjectId)
+	if err != nil {
+		return err
+	}
+	if err = m.repo.Move(ctx, before.ProjectId, newParentId); err != nil {
+		return err
+	}
+	after, err := m.repo.FindById(ctx, before.ProjectId)
+	if err != nil {
+		return err
+	}
+	if err = m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_MOVE, before.ProjectId, before, after); err != nil {
+		return err
+	}
+	return m.recordDescendants(ctx, v1.AuditOperation_AUDIT_OPERATION_MOVE, before.ProjectId, subtree)
 }
 
 func (m *ProjectManager) GetById(ctx context.Context, id string) (proj *Project, err error) {
-	return m.repo.FindById(ctx, id)
+	if err = m.authorize(ctx, id, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
+	if proj, err = m.repo.FindById(ctx, id); ent.IsNotFound(err) {
+		return nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+	}
+	return proj, err
 }
 
 func (m *ProjectManager) GetByName(ctx context.Context, name string) (proj *Project, err error) {
+	if err = m.authorize(ctx, name, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
 	return m.repo.FindByName(ctx, name)
 }
 
-func (m *ProjectManager) RecoverById(ctx context.Context, id string) (err error) {
-	return m.repo.RecoverById(ctx, id)
+// RecoverById restores a soft deleted project out of the trash, together with the descendants that were
+// deleted along with it by a cascading delete.
+//
+// The project cannot be restored while its parent is still in the trash, since it would hang under a deleted
+// project, so the ancestors have to be restored first. Like the deletion, the restoration is recorded in the audit
+// log and the revision history for the project and for each descendant restored along with it.
+func (m *ProjectManager) RecoverById(ctx context.Context, id string) error {
+	if err := m.authorize(ctx, id, v1.Role_ROLE_EDITOR); err != nil {
+		return err
+	}
+	return m.tx.InTx(ctx, func(ctx context.Context) (err error) {
+		var proj *Project
+		if proj, err = m.repo.FindDeletedById(ctx, id); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v in the trash", id)
+			}
+			return err
+		}
+		if proj.ParentProjId != "" {
+			if _, err = m.repo.FindById(ctx, proj.ParentProjId); err != nil {
+				if ent.IsNotFound(err) {
+					return v1.ErrorInvalidParent("The parent project %v should be restored first", proj.ParentProjId)
+				}
+				return err
+			}
+		}
+		var subtree []*Project
+		if subtree, err = m.repo.FindSubtree(ctx, id); err != nil {
+			return err
+		}
+		if err = m.repo.RecoverById(ctx, id); err != nil {
+			return err
+		}
+		var after *Project
+		if after, err = m.repo.FindById(ctx, id); err != nil {
+			return err
+		}
+		if err = m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_RESTORE, id, proj, after); err != nil {
+			return err
+		}
+		return m.recordDescendants(ctx, v1.AuditOperation_AUDIT_OPERATION_RESTORE, id, subtree)
+	})
+}
+
+// ListDeletedProjects retrieves one page of the projects in the trash, see [ProjectManager.ListProjects].
+func (m *ProjectManager) ListDeletedProjects(ctx context.Context, pageSize int32, pageToken string) (projects []*Project, nextPageToken string, err error) {
+	filter := &ListProjectsFilter{Deleted: v1.DeletedFilter_DELETED_FILTER_ONLY}
+	return m.ListProjects(ctx, filter, pageSize, pageToken)
+}
+
+// Purge permanently deletes a soft deleted project together with its soft deleted descendants.
+//
+// The purge is refused while any descendant of the project is still alive, since it would lose its ancestors.
+// The caller needs the admin role on the project.
+func (m *ProjectManager) Purge(ctx context.Context, id string) (err error) {
+	if err = m.authorize(ctx, id, v1.Role_ROLE_ADMIN); err != nil {
+		return err
+	}
+	return m.purge(ctx, id, time.Time{})
+}
+
+// purge permanently deletes the soft deleted project together with its soft deleted descendants, see
+// [ProjectManager.Purge]. Unless the cutoff is zero, the purge is refused as well while any descendant of the
+// project was deleted since the cutoff, so that the projects that have not expired yet keep their ancestors.
+func (m *ProjectManager) purge(ctx context.Context, id string, cutoff time.Time) error {
+	return m.tx.InTx(ctx, func(ctx context.Context) (err error) {
+		var proj *Project
+		if proj, err = m.repo.FindDeletedById(ctx, id); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v in the trash", id)
+			}
+			return err
+		}
+		var alive bool
+		if alive, err = m.repo.HasLiveDescendants(ctx, id); err != nil {
+			return err
+		}
+		if alive {
+			return v1.ErrorInvalidParent("Cannot purge project %v while some of its descendants are not deleted", id)
+		}
+		if !cutoff.IsZero() {
+			var recent bool
+			if recent, err = m.repo.HasDescendantsDeletedSince(ctx, id, cutoff); err != nil {
+				return err
+			}
+			if recent {
+				return v1.ErrorInvalidParent("Cannot purge project %v while some of its descendants have not expired", id)
+			}
+		}
+		// The event is recorded first, while the path of the project can still be read
+		if err = m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_PURGE, id, proj, nil); err != nil {
+			return err
+		}
+		return m.repo.Purge(ctx, id, cutoff)
+	})
+}
+
+// purgeBatchSize is the number of expired projects looked up at once by [ProjectManager.PurgeExpired]
+const purgeBatchSize = 100
+
+// PurgeExpired permanently deletes the projects of every tenant that have stayed in the trash since before the
+// cutoff and returns how many of them were purged.
+//
+// Projects with live descendants, or with descendants deleted since the cutoff, are kept in the trash and skipped,
+// they are purged once their descendants are.
+func (m *ProjectManager) PurgeExpired(ctx context.Context, cutoff time.Time) (purged int, err error) {
+	tenants, err := m.repo.FindTenantsInTrash(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, tenant := range tenants {
+		n, err := m.purgeExpired(NewTenantContext(ctx, tenant), cutoff)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// purgeExpired purges the expired projects of the tenant carried by the context.
+func (m *ProjectManager) purgeExpired(ctx context.Context, cutoff time.Time) (purged int, err error) {
+	skipped := make(map[string]bool)
+	for {
+		ids, err := m.repo.FindExpiredIds(ctx, cutoff, purgeBatchSize+len(skipped))
+		if err != nil {
+			return purged, err
+		}
+		progress := false
+		for _, id := range ids {
+			if skipped[id] {
+				continue
+			}
+			progress = true
+			if err = m.purge(ctx, id, cutoff); err != nil {
+				if !v1.IsInvalidParent(err) && !v1.IsProjectNotFound(err) {
+					return purged, err
+				}
+				// Still has descendants to keep, or already purged along with an expired ancestor
+				skipped[id] = true
+				continue
+			}
+			purged++
+		}
+		if !progress {
+			return purged, nil
+		}
+	}
 }
 
 func (m *ProjectManager) IsProjectIDExist(ctx context.Context, projectID string) (bool, error) {
 	return m.repo.IsProjectIDExist(ctx, projectID)
 }
+
+// RebuildProjectFilter reloads every project ID into the Bloom filter answering [ProjectManager.IsProjectIDExist],
+// which is needed whenever the filter missed some projects, such as after Redis was flushed.
+func (m *ProjectManager) RebuildProjectFilter(ctx context.Context) (int, error) {
+	return m.repo.RebuildProjectFilter(ctx)
+}
+
+// GetProjectPath retrieves the ancestors of the project from the root down to the project itself.
+// The ancestors above the topmost project the caller holds a role on are left out.
 func (m *ProjectManager) GetProjectPath(ctx context.Context, projectId string) ([]*v1.Project, error) {
-	return m.repo.GetProjectPath(ctx, projectId)
+	if err := m.authorize(ctx, projectId, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
+	path, err := m.repo.GetProjectPath(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+	actor, restricted := restrictedActor(ctx)
+	if !restricted {
+		return path, nil
+	}
+	roles, err := m.rolesOf(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range path {
+		if roles[p.ProjectId] != v1.Role_ROLE_UNSPECIFIED {
+			return path[i:], nil
+		}
+	}
+	return nil, nil
 }
-func (m *ProjectManager) FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*v1.Project, error) {
+
+func (m *ProjectManager) FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) (_ []*v1.NearbyProject, err error) {
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, err
+	}
 	return m.repo.FindNearbyProjects(ctx, location, radius)
 }
+
+// GetProjectSubtree retrieves the project together with its descendants down to maxDepth levels below it.
+//
+// The nested tree and the flat breadth-first list of the same projects are both returned, so that the caller
+// can pick whichever representation it needs. A non-positive maxDepth stands for an unlimited depth.
+func (m *ProjectManager) GetProjectSubtree(ctx context.Context, projectId string, maxDepth int32) (root *v1.ProjectNode, projects []*Project, err error) {
+	// The roles on the project extend to the whole subtree
+	if err = m.authorize(ctx, projectId, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, nil, err
+	}
+	if projects, err = m.repo.GetProjectSubtree(ctx, projectId, int(maxDepth)); err != nil {
+		if ent.IsNotFound(err) {
+			return nil, nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v", projectId)
+		}
+		return nil, nil, err
+	}
+
+	// Projects arrive in breadth-first order, so every parent node exists before its children are attached
+	nodes := make(map[string]*v1.ProjectNode, len(projects))
+	for _, p := range projects {
+		node := &v1.ProjectNode{Project: p}
+		if parent, ok := nodes[p.ParentProjId]; ok && p.ProjectId != projectId {
+			node.Depth = parent.Depth + 1
+			parent.Children = append(parent.Children, node)
+		}
+		nodes[p.ProjectId] = node
+	}
+	return nodes[projectId], projects, nil
+}
+
+// FindNearestProjects retrieves the k projects nearest to the location, nearest first.
+// When rootId is not empty, only the subtree rooted at the project rootId is searched.
+func (m *ProjectManager) FindNearestProjects(ctx context.Context, location *v1.GeoPoint, k int32, rootId string) (_ []*v1.NearbyProject, err error) {
+	if location == nil {
+		return nil, v1.ErrorMalformedInput("The location to search around is required")
+	}
+	if k <= 0 || k > maxNearestProjects {
+		return nil, v1.ErrorMalformedInput("The number of nearest projects should be between 1 and %v", maxNearestProjects)
+	}
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, err
+	}
+	return m.repo.FindNearestProjects(ctx, location, int(k), rootId)
+}
+
+// FindProjectsInBounds retrieves the projects located inside the rectangle between the south-west and the north-east
+// corners. When rootId is not empty, only the subtree rooted at the project rootId is searched.
+func (m *ProjectManager) FindProjectsInBounds(ctx context.Context, southWest, northEast *v1.GeoPoint, rootId string) (_ []*Project, err error) {
+	if southWest == nil || northEast == nil {
+		return nil, v1.ErrorMalformedInput("Both corners of the bounds are required")
+	}
+	if southWest.Latitude > northEast.Latitude {
+		return nil, v1.ErrorMalformedInput("The south-west corner should not lie north of the north-east corner")
+	}
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, err
+	}
+	return m.repo.FindProjectsInBounds(ctx, southWest, northEast, rootId)
+}
+
+// validateBoundary checks that the polygon, when given, has enough vertices to enclose an area, none of them missing.
+func validateBoundary(polygon *v1.GeoPolygon) error {
+	if polygon == nil {
+		return nil
+	}
+	points := polygon.Points
+	for i, point := range points {
+		if point == nil {
+			return v1.ErrorMalformedInput("The vertex %v of the polygon is missing", i)
+		}
+	}
+	// A closed ring repeats its first vertex at the end, which does not count as another vertex
+	if n := len(points); n > 1 && points[0].Latitude == points[n-1].Latitude && points[0].Longitude == points[n-1].Longitude {
+		points = points[:n-1]
+	}
+	if len(points) < 3 {
+		return v1.ErrorMalformedInput("A polygon needs at least 3 distinct vertices, got %v", len(points))
+	}
+	return nil
+}
+
+// FindProjectsInPolygon retrieves the projects whose coordinates lie inside the polygon.
+// When rootId is not empty, only the subtree rooted at the project rootId is searched.
+func (m *ProjectManager) FindProjectsInPolygon(ctx context.Context, polygon *v1.GeoPolygon, rootId string) (_ []*Project, err error) {
+	if polygon == nil {
+		return nil, v1.ErrorMalformedInput("The polygon to search within is required")
+	}
+	if err = validateBoundary(polygon); err != nil {
+		return nil, err
+	}
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, err
+	}
+	return m.repo.FindProjectsInPolygon(ctx, polygon, rootId)
+}
+
+// FindProjectsContainingPoint retrieves the projects whose boundaries contain the location.
+// When rootId is not empty, only the subtree rooted at the project rootId is searched.
+func (m *ProjectManager) FindProjectsContainingPoint(ctx context.Context, location *v1.GeoPoint, rootId string) (_ []*Project, err error) {
+	if location == nil {
+		return nil, v1.ErrorMalformedInput("The location to search with is required")
+	}
+	if ctx, err = m.withVisibility(ctx); err != nil {
+		return nil, err
+	}
+	return m.repo.FindProjectsContainingPoint(ctx, location, rootId)
+}
+
+// ImportResult is the outcome of importing one project with [ProjectManager.Import].
+type ImportResult struct {
+	// Created tells whether the project was created rather than updated
+	Created bool
+	// Err is the reason why the project could not be imported, nil on success
+	Err error
+}
+
+// Import creates the given projects, or updates and re-parents them when they already exist.
+//
+// Projects may reference parents that appear anywhere in the same batch, parents are always imported before
+// their children. Every project is imported on its own, so a failure is reported in the result at the same
+// index and does not affect the other projects, except for the descendants of a project that failed.
+func (m *ProjectManager) Import(ctx context.Context, projects []*Project) []ImportResult {
+	results := make([]ImportResult, len(projects))
+	errs := m.inParentOrder(ctx, projects, false, func(ctx context.Context, i int) error {
+		results[i] = m.importOne(ctx, projects[i])
+		return results[i].Err
+	})
+	for i, err := range errs {
+		results[i].Err = err
+	}
+	return results
+}
+
+// importOne creates the project, or updates and re-parents it when it already exists.
+// The update and the move are applied together or not at all.
+func (m *ProjectManager) importOne(ctx context.Context, project *Project) ImportResult {
+	existing, err := m.repo.FindById(ctx, project.ProjectId)
+	if ent.IsNotFound(err) {
+		return ImportResult{Created: true, Err: m.Add(ctx, project)}
+	}
+	if err != nil {
+		return ImportResult{Err: err}
+	}
+	// An import overwrites the existing project, whichever version the imported one was exported from
+	project.Etag = ""
+	err = m.tx.InTx(ctx, func(ctx context.Context) error {
+		if _, err := m.Update(ctx, project, nil); err != nil {
+			return err
+		}
+		if existing.ParentProjId != project.ParentProjId {
+			return m.Move(ctx, project.ProjectId, project.ParentProjId)
+		}
+		return nil
+	})
+	return ImportResult{Err: err}
+}
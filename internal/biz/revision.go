@@ -0,0 +1,160 @@
+package biz
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type ProjectRevision = v1.ProjectRevision
+
+// RevisionRepository represents the interface for operating the revision history of the projects.
+type RevisionRepository interface {
+	// Add stores the revision under the next number of the project and returns that number
+	Add(ctx context.Context, revision *ProjectRevision) (int64, error)
+	Get(ctx context.Context, projectId string, revision int64) (*ProjectRevision, error)
+	// FindAsOf retrieves the latest revision of the project made at or before the time
+	FindAsOf(ctx context.Context, projectId string, at time.Time) (*ProjectRevision, error)
+	// List retrieves at most limit revisions of the project, latest first, starting below the revision before
+	// when it is positive
+	List(ctx context.Context, projectId string, before int64, limit int) ([]*ProjectRevision, error)
+}
+
+// GetAsOf retrieves the project as it was at the time, as recorded by its latest revision made by then.
+//
+// The project is not found when it did not exist yet or was in the trash at the time. The operations on a whole
+// subtree, such as a cascading delete, a restore or a move, make a revision of every descendant they change, and
+// the projects stored before the history was introduced start it with the revisions seeded by the migration.
+func (m *ProjectManager) GetAsOf(ctx context.Context, id string, at time.Time) (*Project, error) {
+	if err := m.authorize(ctx, id, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
+	revision, err := m.revisions.FindAsOf(ctx, id, at)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return nil, v1.ErrorProjectNotFound("Cannot find the specified project with id %v as of %v", id, at)
+		}
+		return nil, err
+	}
+	if revision.Project.DeleteTime != nil {
+		return nil, v1.ErrorProjectNotFound("The project %v was in the trash as of %v", id, at)
+	}
+	return revision.Project, nil
+}
+
+// GetRevision retrieves one revision of the project, which may be in the trash.
+func (m *ProjectManager) GetRevision(ctx context.Context, id string, revision int64) (*ProjectRevision, error) {
+	if err := m.authorize(ctx, id, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
+	rev, err := m.revisions.Get(ctx, id, revision)
+	if ent.IsNotFound(err) {
+		return nil, v1.ErrorProjectNotFound("Cannot find revision %v of project %v", revision, id)
+	}
+	return rev, err
+}
+
+// ListRevisions retrieves one page of the revisions of the project, latest first. The returned token leads to
+// the next page, it is empty once the last page is reached.
+func (m *ProjectManager) ListRevisions(ctx context.Context, id string, pageSize int32, pageToken string) (revisions []*ProjectRevision, nextPageToken string, err error) {
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, "", v1.ErrorMalformedInput("The page size should be between 1 and %v", maxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	var before int64
+	if pageToken != "" {
+		if before, err = decodeSequenceToken(pageToken); err != nil {
+			return nil, "", err
+		}
+	}
+	if err = m.authorize(ctx, id, v1.Role_ROLE_VIEWER); err != nil {
+		return nil, "", err
+	}
+
+	// One more revision than requested tells whether there is a next page
+	if revisions, err = m.revisions.List(ctx, id, before, int(pageSize)+1); err != nil {
+		return nil, "", err
+	}
+	if len(revisions) > int(pageSize) {
+		revisions = revisions[:pageSize]
+		nextPageToken = encodeSequenceToken(revisions[len(revisions)-1].Revision)
+	}
+	return revisions, nextPageToken, nil
+}
+
+// Revert restores the description, the location, the coordinates, the boundary and the parent the project had
+// in an earlier revision. The revert is a change of its own, it makes a new revision rather than rewriting the
+// history, and it is refused like a move when the former parent cannot take the project back.
+//
+// It returns the project after the revert together with the number of the new revision.
+func (m *ProjectManager) Revert(ctx context.Context, id string, revision int64) (after *Project, number int64, err error) {
+	if err = m.authorize(ctx, id, v1.Role_ROLE_EDITOR); err != nil {
+		return nil, 0, err
+	}
+	err = m.tx.InTx(ctx, func(ctx context.Context) error {
+		target, err := m.revisions.Get(ctx, id, revision)
+		if err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find revision %v of project %v", revision, id)
+			}
+			return err
+		}
+		before, err := m.repo.FindById(ctx, id)
+		if err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Cannot find the specified project with id %v", id)
+			}
+			return err
+		}
+
+		reverted := proto.Clone(before).(*Project)
+		reverted.Desc = target.Project.Desc
+		reverted.Location = target.Project.Location
+		reverted.Coordinate = target.Project.Coordinate
+		reverted.Boundary = target.Project.Boundary
+		// A revert applies whatever the current version is, like an update without an entity tag
+		reverted.Etag = ""
+		if err = m.repo.Update(ctx, reverted, updatableFields); err != nil {
+			return err
+		}
+		var subtree []*Project
+		if parent := target.Project.ParentProjId; parent != before.ParentProjId {
+			if err = m.checkMove(ctx, id, parent); err != nil {
+				return err
+			}
+			if subtree, err = m.repo.FindSubtree(ctx, id); err != nil {
+				return err
+			}
+			if err = m.repo.Move(ctx, id, parent); err != nil {
+				return err
+			}
+		}
+
+		if after, err = m.repo.FindById(ctx, id); err != nil {
+			return err
+		}
+		if err = m.record(ctx, v1.AuditOperation_AUDIT_OPERATION_REVERT, id, before, after); err != nil {
+			return err
+		}
+		// The descendants only follow the project to its former parent
+		if err = m.recordDescendants(ctx, v1.AuditOperation_AUDIT_OPERATION_MOVE, id, subtree); err != nil {
+			return err
+		}
+		// The revert made the latest revision, which the transaction keeps others from adding meanwhile
+		rev, err := m.revisions.List(ctx, id, 0, 1)
+		if err != nil {
+			return err
+		}
+		number = rev[0].Revision
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return after, number, nil
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+// grantRole grants the role on the project of the tenant to the user, failing the test if it cannot.
+func grantRole(t *testing.T, mgr *biz.ProjectManager, tenant, user, id string, role v1.Role) {
+	t.Helper()
+	ctx := biz.NewTenantContext(context.Background(), tenant)
+	membership := &biz.Membership{PrincipalType: v1.PrincipalType_PRINCIPAL_TYPE_USER, PrincipalId: user, ProjectId: id, Role: role}
+	if _, err := mgr.GrantRole(ctx, membership); err != nil {
+		t.Fatalf("failed to grant the role %v on %v to %v: %v", role, id, user, err)
+	}
+}
+
+func TestReparentingDeleteNeedsTheGrandparent(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	addProject(t, mgr, "a", "grandparent", "")
+	addProject(t, mgr, "a", "parent", "grandparent")
+	addProject(t, mgr, "a", "child", "parent")
+	addProject(t, mgr, "a", "root", "")
+	addProject(t, mgr, "a", "root-child", "root")
+	grantRole(t, mgr, "a", "user", "parent", v1.Role_ROLE_EDITOR)
+	grantRole(t, mgr, "a", "user", "root", v1.Role_ROLE_EDITOR)
+	ctx := biz.NewActorContext(biz.NewTenantContext(context.Background(), "a"), &biz.Actor{Subject: "user", Tenant: "a"})
+
+	if err := mgr.RemoveById(ctx, "parent", v1.DeletionPolicy_DELETION_POLICY_REPARENT, ""); !v1.IsPermissionDenied(err) {
+		t.Errorf("re-parenting under a project the caller cannot edit: got %v, want PERMISSION_DENIED", err)
+	}
+	if err := mgr.RemoveById(ctx, "root", v1.DeletionPolicy_DELETION_POLICY_REPARENT, ""); !v1.IsPermissionDenied(err) {
+		t.Errorf("turning the children into roots: got %v, want PERMISSION_DENIED", err)
+	}
+	if child, err := repo.FindById(ctx, "child"); err != nil || child.ParentProjId != "parent" {
+		t.Errorf("the child should stay under its parent: got %v, %v", child, err)
+	}
+
+	grantRole(t, mgr, "a", "user", "grandparent", v1.Role_ROLE_EDITOR)
+	if err := mgr.RemoveById(ctx, "parent", v1.DeletionPolicy_DELETION_POLICY_REPARENT, ""); err != nil {
+		t.Fatalf("re-parenting under a project the caller can edit: %v", err)
+	}
+	if child, err := repo.FindById(ctx, "child"); err != nil || child.ParentProjId != "grandparent" {
+		t.Errorf("the child should hang under its grandparent: got %v, %v", child, err)
+	}
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/ent"
+	"project/internal/ent/auditevent"
+	"project/internal/ent/predicate"
+	"project/internal/ent/project"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// auditRepo implements the interface [biz.AuditRepository] described in the package [project/internal/biz].
+type auditRepo struct {
+	db *Data
+}
+
+// NewAuditRepository creates a new audit repository implementation instance and returns the interface value.
+func NewAuditRepository(database *Data) biz.AuditRepository {
+	return &auditRepo{db: database}
+}
+
+// auditOperations are the values of the enum of the entity for the enum of the messages
+var auditOperations = map[v1.AuditOperation]auditevent.Operation{
+	v1.AuditOperation_AUDIT_OPERATION_CREATE:  auditevent.OperationCreate,
+	v1.AuditOperation_AUDIT_OPERATION_UPDATE:  auditevent.OperationUpdate,
+	v1.AuditOperation_AUDIT_OPERATION_DELETE:  auditevent.OperationDelete,
+	v1.AuditOperation_AUDIT_OPERATION_RESTORE: auditevent.OperationRestore,
+	v1.AuditOperation_AUDIT_OPERATION_MOVE:    auditevent.OperationMove,
+	v1.AuditOperation_AUDIT_OPERATION_PURGE:   auditevent.OperationPurge,
+	v1.AuditOperation_AUDIT_OPERATION_REVERT:  auditevent.OperationRevert,
+}
+
+// Helper function to convert from ent.AuditEvent to biz.AuditEvent
+func convertToBizAuditEvent(e *ent.AuditEvent) (event *biz.AuditEvent, err error) {
+	event = &biz.AuditEvent{
+		Id:         int64(e.ID),
+		Actor:      e.Actor,
+		ProjectId:  e.ProjectID,
+		RequestId:  e.RequestID,
+		CreateTime: timestamppb.New(e.CreateTime),
+	}
+	for op, value := range auditOperations {
+		if value == e.Operation {
+			event.Operation = op
+		}
+	}
+	if e.Before != "" {
+		event.Before = &biz.Project{}
+		if err = protojson.Unmarshal([]byte(e.Before), event.Before); err != nil {
+			return nil, err
+		}
+	}
+	if e.After != "" {
+		event.After = &biz.Project{}
+		if err = protojson.Unmarshal([]byte(e.After), event.After); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// Record writes the event together with the current path of the project, which the subtree filters match.
+func (r *auditRepo) Record(ctx context.Context, event *biz.AuditEvent) error {
+	tenant := biz.TenantFromContext(ctx)
+	create := r.db.DB(ctx).AuditEvent.Create().
+		SetTenantID(tenant).
+		SetActor(event.Actor).
+		SetOperation(auditOperations[event.Operation]).
+		SetProjectID(event.ProjectId).
+		SetRequestID(event.RequestId)
+	proj, err := r.db.DB(ctx).Project.Query().
+		Where(project.TenantID(tenant), project.ProjectID(event.ProjectId)).
+		Select(project.FieldPath).
+		First(ctx)
+	if err != nil {
+		return err
+	}
+	create.SetProjectPath(proj.Path)
+	if event.Before != nil {
+		raw, err := protojson.Marshal(event.Before)
+		if err != nil {
+			return err
+		}
+		create.SetBefore(string(raw))
+	}
+	if event.After != nil {
+		raw, err := protojson.Marshal(event.After)
+		if err != nil {
+			return err
+		}
+		create.SetAfter(string(raw))
+	}
+	return create.Exec(ctx)
+}
+
+// List retrieves at most limit events matching the filter, latest first, starting below the event ID before.
+func (r *auditRepo) List(ctx context.Context, filter *biz.AuditFilter, before int64, limit int) ([]*biz.AuditEvent, error) {
+	visible, err := r.eventsVisibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := r.db.DB(ctx).AuditEvent.Query().
+		Where(auditevent.TenantID(biz.TenantFromContext(ctx))).
+		Where(visible...)
+	switch {
+	case filter.ProjectId != "" && filter.IncludeSubtree:
+		subtree, err := r.eventsOfSubtrees(ctx, filter.ProjectId)
+		if err != nil {
+			return nil, err
+		}
+		query.Where(subtree)
+	case filter.ProjectId != "":
+		query.Where(auditevent.ProjectID(filter.ProjectId))
+	}
+	if filter.Actor != "" {
+		query.Where(auditevent.Actor(filter.Actor))
+	}
+	if !filter.StartTime.IsZero() {
+		query.Where(auditevent.CreateTimeGTE(filter.StartTime))
+	}
+	if !filter.EndTime.IsZero() {
+		query.Where(auditevent.CreateTimeLT(filter.EndTime))
+	}
+	if before > 0 {
+		query.Where(auditevent.IDLT(int(before)))
+	}
+	// Events are numbered in the order they are written, so the IDs order them by time
+	events, err := query.Order(ent.Desc(auditevent.FieldID)).Limit(limit).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bizEvents := make([]*biz.AuditEvent, 0, len(events))
+	for _, e := range events {
+		event, err := convertToBizAuditEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		bizEvents = append(bizEvents, event)
+	}
+	return bizEvents, nil
+}
+
+// eventsVisibleToCaller restricts a query to the events of the subtrees the caller may see, like [visibleToCaller].
+// The subtrees are matched against the paths of the projects when they changed.
+func (r *auditRepo) eventsVisibleToCaller(ctx context.Context) ([]predicate.AuditEvent, error) {
+	roots, restricted := biz.VisibleRootsFromContext(ctx)
+	if !restricted {
+		return nil, nil
+	}
+	subtrees, err := r.eventsOfSubtrees(ctx, roots...)
+	if err != nil {
+		return nil, err
+	}
+	return []predicate.AuditEvent{subtrees}, nil
+}
+
+// eventsOfSubtrees matches the events of the projects that belonged to the subtrees of the roots when they changed.
+//
+// The events are matched by the prefix of their paths, which the index on the paths serves. A root that moved had
+// several paths, so the prefixes are all the paths recorded by the events of the roots, together with their current
+// paths. Nothing matches when no path of the roots is known.
+func (r *auditRepo) eventsOfSubtrees(ctx context.Context, roots ...string) (predicate.AuditEvent, error) {
+	if len(roots) == 0 {
+		return auditevent.ProjectIDIn(), nil
+	}
+	tenant := biz.TenantFromContext(ctx)
+	recorded, err := r.db.DB(ctx).AuditEvent.Query().
+		Where(auditevent.TenantID(tenant), auditevent.ProjectIDIn(roots...), auditevent.ProjectPathNEQ("")).
+		Unique(true).
+		Select(auditevent.FieldProjectPath).
+		Strings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.db.DB(ctx).Project.Query().
+		Where(project.TenantID(tenant), project.ProjectIDIn(roots...), project.PathNEQ("")).
+		Select(project.FieldPath).
+		Strings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// An empty path is never a prefix, since it would match the events of every project
+	var subtrees []predicate.AuditEvent
+	seen := make(map[string]bool)
+	for _, path := range append(recorded, current...) {
+		if !seen[path] {
+			seen[path] = true
+			subtrees = append(subtrees, auditevent.ProjectPathHasPrefix(path))
+		}
+	}
+	if len(subtrees) == 0 {
+		return auditevent.ProjectIDIn(), nil
+	}
+	return auditevent.Or(subtrees...), nil
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+func TestSubtreeFiltersFollowTheMovesOfTheRoot(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	addProject(t, mgr, "a", "site", "")
+	addProject(t, mgr, "a", "unit", "site")
+	addProject(t, mgr, "a", "other", "")
+	addProject(t, mgr, "a", "elsewhere", "")
+	ctx := biz.NewTenantContext(context.Background(), "a")
+	if err := mgr.Move(ctx, "site", "other"); err != nil {
+		t.Fatalf("moving the site: %v", err)
+	}
+	update := &biz.Project{ProjectId: "unit", Desc: "changed"}
+	if _, err := mgr.Update(ctx, update, []string{"desc"}); err != nil {
+		t.Fatalf("updating the unit: %v", err)
+	}
+
+	// The events of the unit were recorded under both paths of the site
+	events, _, err := mgr.ListAuditEvents(ctx, &biz.AuditFilter{ProjectId: "site", IncludeSubtree: true}, 100, "")
+	if err != nil {
+		t.Fatalf("listing the events of the subtree: %v", err)
+	}
+	operations := make(map[string][]v1.AuditOperation)
+	for _, e := range events {
+		operations[e.ProjectId] = append(operations[e.ProjectId], e.Operation)
+	}
+	if got := operations["unit"]; len(got) != 3 {
+		t.Errorf("the events of the unit: got %v, want its creation, its move along the site and its update", got)
+	}
+	if got := operations["other"]; len(got) != 0 {
+		t.Errorf("the events of the parent of the site: got %v, want none", got)
+	}
+
+	// A caller holding a role on the site sees the same events
+	grantRole(t, mgr, "a", "viewer", "site", v1.Role_ROLE_VIEWER)
+	viewer := biz.NewActorContext(ctx, &biz.Actor{Subject: "viewer", Tenant: "a"})
+	visible, _, err := mgr.ListAuditEvents(viewer, &biz.AuditFilter{}, 100, "")
+	if err != nil || len(visible) != len(events) {
+		t.Errorf("the events visible to a viewer of the site: got %d, %v, want %d", len(visible), err, len(events))
+	}
+
+	projects, err := mgr.FindProjectsInBounds(ctx, &v1.GeoPoint{}, &v1.GeoPoint{Latitude: 3, Longitude: 3}, "other")
+	if err != nil {
+		t.Fatalf("searching the subtree: %v", err)
+	}
+	var ids []string
+	for _, p := range projects {
+		ids = append(ids, p.ProjectId)
+	}
+	sort.Strings(ids)
+	if len(ids) != 3 || ids[0] != "other" || ids[1] != "site" || ids[2] != "unit" {
+		t.Errorf("the projects of the subtree: got %v, want other, site and unit", ids)
+	}
+	if projects, err = mgr.FindProjectsInBounds(ctx, &v1.GeoPoint{}, &v1.GeoPoint{Latitude: 3, Longitude: 3}, "missing"); err != nil || len(projects) != 0 {
+		t.Errorf("searching the subtree of a missing project: got %d projects, %v, want none", len(projects), err)
+	}
+}
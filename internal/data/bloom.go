@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+	"project/internal/ent/project"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// projectNamesKey is the Redis key of the Bloom filter holding every project ID, qualified by its tenant
+const projectNamesKey = "project:names"
+
+// projectNamesLockKey is the Redis key of the lock held by the instance rebuilding the Bloom filter
+const projectNamesLockKey = projectNamesKey + ":lock"
+
+// bloomRebuildLockTTL bounds how long the lock on the rebuild and the filter being built outlive an instance that
+// stops in the middle of a rebuild. Both are kept alive after every batch of project IDs.
+const bloomRebuildLockTTL = time.Minute
+
+// Default sizing of the Bloom filter when the config leaves it out
+const (
+	defaultBloomCapacity  = 1000000
+	defaultBloomErrorRate = 0.01
+)
+
+// bloomScanBatch is the number of project IDs read from the db at once while rebuilding the filter
+const bloomScanBatch = 1000
+
+// The metrics of the Bloom filter. Dividing the false positives by the positive lookups gives the observed
+// false-positive rate, which should stay close to the configured error rate as long as the filter is not
+// filled beyond its capacity.
+var (
+	bloomLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "project_bloom_lookups_total",
+		Help: "Lookups of project IDs in the Bloom filter by result: positive, negative, or bypassed while the filter is not built.",
+	}, []string{"result"})
+	bloomFalsePositives = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "project_bloom_false_positives_total",
+		Help: "Positive lookups in the Bloom filter of project IDs that the db does not hold.",
+	})
+	bloomRebuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "project_bloom_rebuilds_total",
+		Help: "Rebuilds of the Bloom filter of project IDs by backend: redis or local.",
+	}, []string{"backend"})
+	bloomItems = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "project_bloom_items",
+		Help: "Number of project IDs loaded into the Bloom filter by the last rebuild.",
+	})
+)
+
+// projectFilter is the Bloom filter of the project IDs, which answers most lookups of absent projects without
+// querying the db.
+//
+// The filter lives in Redis when the RedisBloom module is available, and in the memory of the process otherwise.
+// Until the filter is first built from the db, it cannot tell anything, so every lookup falls back to the db.
+type projectFilter struct {
+	client    *redis.Client
+	capacity  int64
+	errorRate float64
+
+	mu    sync.RWMutex
+	ready bool
+	// local is the in-process filter, it is nil when the filter lives in Redis
+	local *localBloom
+	// buildingKey and building are the filter being rebuilt, which receives the additions made meanwhile
+	buildingKey string
+	building    *localBloom
+}
+
+func newProjectFilter(client *redis.Client, capacity int64, errorRate float64) *projectFilter {
+	return &projectFilter{client: client, capacity: capacity, errorRate: errorRate}
+}
+
+// add records the project ID into the filter, together with the filter being rebuilt if any.
+func (f *projectFilter) add(ctx context.Context, id string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.building != nil {
+		f.building.add(id)
+	} else if f.buildingKey != "" {
+		f.client.BFAdd(ctx, f.buildingKey, id)
+	}
+	if f.local != nil {
+		f.local.add(id)
+		return
+	}
+	if err := f.client.BFAdd(ctx, projectNamesKey, id).Err(); err != nil {
+		log.Warnf("failed to add %v to the Bloom filter: %v", id, err)
+	}
+}
+
+// mayContain reports whether the project ID may be held by the db. A false answer is definitive,
+// while a true answer still has to be confirmed by the db. known is false when the filter cannot tell.
+func (f *projectFilter) mayContain(ctx context.Context, id string) (maybe bool, known bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.ready {
+		return true, false
+	}
+	if f.local != nil {
+		return f.local.test(id), true
+	}
+	// A flushed Redis answers every lookup negatively, so the filter is only trusted while its key is there
+	var exists *redis.BoolCmd
+	var present *redis.IntCmd
+	if _, err := f.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.BFExists(ctx, projectNamesKey, id)
+		present = pipe.Exists(ctx, projectNamesKey)
+		return nil
+	}); err != nil {
+		log.Warnf("failed to look %v up in the Bloom filter: %v", id, err)
+		return true, false
+	}
+	if present.Val() == 0 {
+		return true, false
+	}
+	return exists.Val(), true
+}
+
+// rebuild replaces the filter with a new one holding every project ID of the db and returns how many IDs were
+// loaded. The filter is built aside and swapped in at the end, so lookups keep being answered meanwhile.
+//
+// The instances sharing the filter rebuild it one at a time, under a lock in Redis. While another instance holds
+// the lock, the rebuild fails with the reason CONFLICT, and an instance whose filter is not built yet uses the
+// one in Redis, which the other instance replaces once done. Every rebuild builds its filter under a key of its own, so a rebuild that
+// outlives its lock cannot spoil the filter of the next one.
+//
+// RedisBloom is probed on every rebuild, so the filter moves back into Redis once the module becomes available.
+func (f *projectFilter) rebuild(ctx context.Context, client *ent.Client) (int, error) {
+	token := uuid.NewString()
+	locked, err := f.client.SetNX(ctx, projectNamesLockKey, token, bloomRebuildLockTTL).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		f.mu.Lock()
+		if !f.ready {
+			f.local, f.ready = nil, true
+		}
+		f.mu.Unlock()
+		return 0, v1.ErrorConflict("The Bloom filter of project IDs is being rebuilt by another instance")
+	}
+	defer func() {
+		err := compareAndDelete.Run(context.WithoutCancel(ctx), f.client, []string{projectNamesLockKey}, token).Err()
+		if err != nil {
+			log.Warnf("failed to release the lock on the rebuild of the Bloom filter: %v", err)
+		}
+	}()
+
+	buildingKey := projectNamesKey + ":rebuild:" + token
+	var building *localBloom
+	if err = f.client.BFReserve(ctx, buildingKey, f.errorRate, f.capacity).Err(); err != nil {
+		if !isUnknownCommand(err) {
+			return 0, err
+		}
+		log.Warnf("RedisBloom is not available, the Bloom filter of project IDs is kept in the process: %v", err)
+		buildingKey, building = "", newLocalBloom(f.capacity, f.errorRate)
+	}
+	// keepAlive extends the lock, together with the filter being built which is dropped by a failed rebuild
+	keepAlive := func() error {
+		extended, err := compareAndExpire.Run(ctx, f.client, []string{projectNamesLockKey}, token,
+			bloomRebuildLockTTL.Milliseconds()).Int()
+		if err == nil && extended == 0 {
+			err = errors.New("the lock on the rebuild of the Bloom filter expired")
+		}
+		if err == nil && buildingKey != "" {
+			err = f.client.Expire(ctx, buildingKey, bloomRebuildLockTTL).Err()
+		}
+		return err
+	}
+	if err = keepAlive(); err != nil {
+		return 0, err
+	}
+	if buildingKey != "" {
+		defer f.client.Del(context.WithoutCancel(ctx), buildingKey)
+	}
+
+	f.mu.Lock()
+	f.buildingKey, f.building = buildingKey, building
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.buildingKey, f.building = "", nil
+		f.mu.Unlock()
+	}()
+
+	count, lastId := 0, 0
+	for {
+		var rows []struct {
+			ID        int    `json:"id"`
+			TenantID  string `json:"tenant_id"`
+			ProjectID string `json:"project_id"`
+		}
+		// Soft deleted projects are loaded as well, since they still hold their IDs.
+		// The filter is shared by all the tenants, whose IDs are told apart by qualifying them with the tenant.
+		if err := client.Project.Query().
+			Where(project.IDGT(lastId)).
+			Order(ent.Asc(project.FieldID)).
+			Limit(bloomScanBatch).
+			Select(project.FieldID, project.FieldTenantID, project.FieldProjectID).
+			Scan(ctx, &rows); err != nil {
+			return count, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		ids := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			id := tenantScoped(row.TenantID, row.ProjectID)
+			ids = append(ids, id)
+			if building != nil {
+				building.add(id)
+			}
+		}
+		if building == nil {
+			if err := f.client.BFMAdd(ctx, buildingKey, ids...).Err(); err != nil {
+				return count, err
+			}
+		}
+		count += len(rows)
+		lastId = rows[len(rows)-1].ID
+		if err := keepAlive(); err != nil {
+			return count, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if building == nil {
+		// The filter keeps the lifetime of the key it was built under unless it is made persistent
+		if _, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, buildingKey, projectNamesKey)
+			pipe.Persist(ctx, projectNamesKey)
+			return nil
+		}); err != nil {
+			return count, err
+		}
+		f.local = nil
+		bloomRebuilds.WithLabelValues("redis").Inc()
+	} else {
+		f.local = building
+		bloomRebuilds.WithLabelValues("local").Inc()
+	}
+	f.ready = true
+	bloomItems.Set(float64(count))
+	return count, nil
+}
+
+// isUnknownCommand reports whether Redis rejected a command it does not know, such as the commands of a
+// module that is not loaded.
+func isUnknownCommand(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(strings.ToLower(redisErr.Error()), "err unknown command")
+}
+
+// localBloom is a Bloom filter kept in the memory of the process.
+type localBloom struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	hashes uint64
+	// seeds of the two independent hashes the positions of an item are derived from
+	seed1, seed2 maphash.Seed
+}
+
+// newLocalBloom sizes the filter so that holding capacity items yields the error rate.
+func newLocalBloom(capacity int64, errorRate float64) *localBloom {
+	n := math.Max(float64(capacity), 1)
+	m := math.Ceil(-n * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(math.Round(m/n*math.Ln2), 1)
+	return &localBloom{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint64(k),
+		seed1:  maphash.MakeSeed(),
+		seed2:  maphash.MakeSeed(),
+	}
+}
+
+// positions returns the bits of the item, derived from two independent hashes by double hashing.
+// The filter never leaves the process, so the hashes do not need to be stable across processes.
+func (b *localBloom) positions(item string) []uint64 {
+	h1, h2 := maphash.String(b.seed1, item), maphash.String(b.seed2, item)|1
+	size := uint64(len(b.bits)) * 64
+	positions := make([]uint64, b.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+	return positions
+}
+
+func (b *localBloom) add(item string) {
+	positions := b.positions(item)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, p := range positions {
+		b.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+func (b *localBloom) test(item string) bool {
+	positions := b.positions(item)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, p := range positions {
+		if b.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+func TestBulkImportFailsTheFaultyProjectsAlone(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	ctx := biz.NewTenantContext(context.Background(), "a")
+	imp, err := mgr.NewBulkImport(ctx, "import")
+	if err != nil {
+		t.Fatalf("starting the import: %v", err)
+	}
+
+	// The path of the long ID exceeds its column, so the db refuses it together with its child
+	long := strings.Repeat("x", 800)
+	projects := []*biz.Project{
+		{ProjectId: "root"},
+		{ProjectId: "flat", ParentProjId: "root", Boundary: &v1.GeoPolygon{Points: []*v1.GeoPoint{{}, {Latitude: 1}}}},
+		{ProjectId: long, ParentProjId: "root"},
+		{ProjectId: "sibling", ParentProjId: "root"},
+		{ProjectId: "orphan", ParentProjId: long},
+	}
+	var failures []biz.ImportFailure
+	for i, p := range projects {
+		p.Coordinate = &v1.GeoPoint{Latitude: 1, Longitude: 2}
+		_, chunk, err := imp.Add(ctx, int64(i), p)
+		if err != nil {
+			t.Fatalf("importing the project %d: %v", i, err)
+		}
+		failures = append(failures, chunk...)
+	}
+	chunk, err := imp.Close(ctx)
+	if err != nil {
+		t.Fatalf("closing the import: %v", err)
+	}
+	failures = append(failures, chunk...)
+
+	failed := make(map[int64]error, len(failures))
+	for _, f := range failures {
+		failed[f.Index] = f.Err
+	}
+	if !v1.IsMalformedInput(failed[1]) {
+		t.Errorf("the project with an invalid boundary: got %v, want MALFORMED_INPUT", failed[1])
+	}
+	if failed[2] == nil || !v1.IsInvalidParent(failed[4]) || len(failed) != 3 {
+		t.Errorf("got the failures %v, want the long ID and its child to fail", failed)
+	}
+	if progress := imp.Progress(); progress.Created != 2 || progress.Failed != 3 {
+		t.Errorf("got %+v, want 2 projects created and 3 failed", progress)
+	}
+	for _, id := range []string{"root", "sibling"} {
+		if _, err := repo.FindById(ctx, id); err != nil {
+			t.Errorf("the project %v should be imported: %v", id, err)
+		}
+	}
+}
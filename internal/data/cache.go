@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"project/internal/biz"
+	"project/internal/ent"
+	"project/internal/ent/project"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Default lifetimes of the cached lookups when the config leaves them out
+const (
+	defaultProjectTTL  = 10 * time.Minute
+	defaultPathTTL     = 10 * time.Minute
+	defaultNotFoundTTL = 30 * time.Second
+)
+
+// cachedNotFound is the value cached for a project that does not exist. It cannot be mistaken for a cached
+// project, which is always encoded as a JSON object or array.
+const cachedNotFound = "null"
+
+// errCachedNotFound answers the lookups of the projects cached as absent. Callers only check it with
+// ent.IsNotFound, the label of the error cannot be set outside the ent package anyway.
+var errCachedNotFound = &ent.NotFoundError{}
+
+// The scripts changing a key only while it still holds the value written by the caller, such as a lock that may
+// have expired and been taken by another instance in the meantime. They reply 1 when the key was changed, 0 otherwise.
+var (
+	// compareAndDelete deletes the key KEYS[1] if it holds ARGV[1]
+	compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// compareAndExpire sets the lifetime of the key KEYS[1] to ARGV[2] milliseconds if it holds ARGV[1]
+	compareAndExpire = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// compareAndSet sets the key KEYS[1] to ARGV[2] if it holds ARGV[1], for ARGV[3] milliseconds unless it is not
+	// positive
+	compareAndSet = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	if tonumber(ARGV[3]) > 0 then
+		redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	else
+		redis.call("SET", KEYS[1], ARGV[2])
+	end
+	return 1
+end
+return 0`)
+)
+
+// durationOr returns the configured duration, or the fallback when it is not configured.
+func durationOr(d *durationpb.Duration, fallback time.Duration) time.Duration {
+	if d == nil {
+		return fallback
+	}
+	return d.AsDuration()
+}
+
+// projectKey is the cache key of the project of the tenant looked up by its ID.
+func projectKey(tenant, id string) string {
+	return "project:id:" + tenantScoped(tenant, id)
+}
+
+// projectPathKey is the cache key of the ancestors of the project of the tenant.
+func projectPathKey(tenant, id string) string {
+	return "project:path:" + tenantScoped(tenant, id)
+}
+
+// readThrough returns the value cached under the key. On a miss, the value is loaded by load and cached for ttl,
+// while a not found error is cached for [Cache.NotFoundTTL] so that lookups of absent projects spare the database.
+//
+// Concurrent misses of the same key share a single load. The cache only speeds the lookups up, so its failures
+// are logged and the value is loaded from the database instead.
+func (c *Cache) readThrough(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	raw, err := c.Client.Get(ctx, key).Bytes()
+	switch {
+	case err == nil && string(raw) == cachedNotFound:
+		return nil, errCachedNotFound
+	case err == nil:
+		return raw, nil
+	case !errors.Is(err, redis.Nil):
+		log.Warnf("failed to read %v from the cache: %v", key, err)
+	}
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// The load is shared by the callers, so it must not be interrupted when the first of them gives up
+		ctx := context.WithoutCancel(ctx)
+		raw, err := load(ctx)
+		switch {
+		case err == nil:
+			c.set(ctx, key, raw, ttl)
+		case ent.IsNotFound(err):
+			c.set(ctx, key, cachedNotFound, c.NotFoundTTL)
+		}
+		return raw, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// set caches the value under the key for ttl, a non-positive ttl disables the caching.
+func (c *Cache) set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	if err := c.Client.Set(ctx, key, value, ttl).Err(); err != nil {
+		log.Warnf("failed to write %v to the cache: %v", key, err)
+	}
+}
+
+// invalidate drops the cached lookups of the projects once the transaction bound to the context is committed,
+// so that concurrent readers cannot cache the state from before the transaction again.
+func (r *projectRepo) invalidate(ctx context.Context, ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+	tenant := biz.TenantFromContext(ctx)
+	keys := make([]string, 0, 2*len(ids))
+	for _, id := range ids {
+		keys = append(keys, projectKey(tenant, id), projectPathKey(tenant, id))
+	}
+	r.db.afterCommit(ctx, func() {
+		if err := r.cache.Client.Del(context.WithoutCancel(ctx), keys...).Err(); err != nil {
+			log.Warnf("failed to invalidate the cached projects %v: %v", ids, err)
+		}
+	})
+}
+
+// invalidateSubtree drops the cached lookups of the project and its descendants. The ancestors of the descendants
+// include the project, so their cached paths become stale as soon as the project changes.
+func (r *projectRepo) invalidateSubtree(ctx context.Context, proj *ent.Project) error {
+	subtree, err := subtreeOf(proj)
+	if err != nil {
+		return err
+	}
+	ids, err := r.query(ctx).
+		Where(subtree).
+		Select(project.FieldProjectID).
+		Strings(ctx)
+	if err != nil {
+		return err
+	}
+	r.invalidate(ctx, ids...)
+	return nil
+}
+
+// marshalProjects encodes the projects cached together, such as the ancestors of a project.
+func marshalProjects(projects []*biz.Project) ([]byte, error) {
+	items := make([]json.RawMessage, 0, len(projects))
+	for _, p := range projects {
+		raw, err := protojson.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, raw)
+	}
+	return json.Marshal(items)
+}
+
+// unmarshalProjects decodes the projects encoded by [marshalProjects].
+func unmarshalProjects(raw []byte) ([]*biz.Project, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	projects := make([]*biz.Project, 0, len(items))
+	for _, item := range items {
+		p := &biz.Project{}
+		if err := protojson.Unmarshal(item, p); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, nil
+}
@@ -4,12 +4,17 @@
 package data
 
 import (
+	"context"
+	"fmt"
 	"github.com/redis/go-redis/v9"
+	"project/internal/biz"
 	"project/internal/conf"
 	"project/internal/ent"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/wire"
+	"golang.org/x/sync/singleflight"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -18,20 +23,106 @@ import (
 var ProviderSet = wire.NewSet(
 	NewData,
 	NewCache,
+	NewTransaction,
 	NewProjectRepository,
+	NewMembershipRepository,
+	NewAuditRepository,
+	NewRevisionRepository,
+	NewIdempotencyRepository,
+	NewIdGenerator,
 )
 
 // Data wraps the db client
 type Data struct {
 	Client *ent.Client
+	// Driver is the name of the database driver, which decides whether spatial queries run in the database
+	Driver string
+}
+
+// contextTxKey is the context key under which [Data.InTx] stores the running transaction
+type contextTxKey struct{}
+
+// InTx runs fn inside a database transaction, which is committed if fn succeeds and rolled back otherwise.
+//
+// Repositories pick the transaction up from the context passed to fn through [Data.DB], so several repository
+// calls are applied atomically. Nested calls join the outermost transaction.
+func (d *Data) InTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(contextTxKey{}).(*ent.Tx); ok {
+		return fn(ctx)
+	}
+	var tx *ent.Tx
+	if tx, err = d.Client.Tx(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			_ = tx.Rollback()
+			panic(v)
+		}
+	}()
+	if err = fn(context.WithValue(ctx, contextTxKey{}, tx)); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			err = fmt.Errorf("%w: rolling back transaction: %v", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// afterCommit runs fn once the transaction bound to the context is committed, or right away when there is none.
+// Nothing runs when the transaction is rolled back.
+func (d *Data) afterCommit(ctx context.Context, fn func()) {
+	tx, ok := ctx.Value(contextTxKey{}).(*ent.Tx)
+	if !ok {
+		fn()
+		return
+	}
+	tx.OnCommit(func(next ent.Committer) ent.Committer {
+		return ent.CommitFunc(func(ctx context.Context, tx *ent.Tx) error {
+			err := next.Commit(ctx, tx)
+			if err == nil {
+				fn()
+			}
+			return err
+		})
+	})
+}
+
+// inTx reports whether a transaction is bound to the context
+func (d *Data) inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(contextTxKey{}).(*ent.Tx)
+	return ok
+}
+
+// NewTransaction exposes the transactions of the db to the biz layer
+func NewTransaction(d *Data) biz.Transaction {
+	return d
+}
+
+// DB returns the client of the transaction bound to the context, or the plain client when there is none
+func (d *Data) DB(ctx context.Context) *ent.Client {
+	if tx, ok := ctx.Value(contextTxKey{}).(*ent.Tx); ok {
+		return tx.Client()
+	}
+	return d.Client
 }
 
 // Cache wraps the Redis client
 type Cache struct {
 	Client *redis.Client
+	// ProjectTTL, PathTTL and NotFoundTTL are the lifetimes of the cached lookups, see [Cache.readThrough]
+	ProjectTTL  time.Duration
+	PathTTL     time.Duration
+	NotFoundTTL time.Duration
+	// IdempotencyTTL is how long the replies of the requests carrying idempotency keys are kept for their retries
+	IdempotencyTTL time.Duration
+	// group merges the concurrent loads of the same key
+	group singleflight.Group
+	// names is the Bloom filter of the project IDs
+	names *projectFilter
 }
 
-// NewData establishes the connection to the db based on the configuration
+// NewData establishes the connection to the db based on the configuration, and migrates the db, see [Data.Migrate]
 func NewData(c *conf.Data) (data *Data, cleanup func(), err error) {
 	var dbClient *ent.Client
 	if dbClient, err = ent.Open(c.Database.Driver, c.Database.Source); err != nil {
@@ -43,7 +134,14 @@ func NewData(c *conf.Data) (data *Data, cleanup func(), err error) {
 			log.Error(err)
 		}
 	}
-	data = &Data{Client: dbClient}
+	data = &Data{Client: dbClient, Driver: c.Database.Driver}
+	if err == nil {
+		// The requests are only served once the database is up to date
+		if err = data.Migrate(context.Background()); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
 	return
 }
 
@@ -61,6 +159,20 @@ func NewCache(c *conf.Data) (cache *Cache, cleanup func(), err error) {
 			log.Error(err)
 		}
 	}
-	cache = &Cache{Client: rdb}
+	capacity, errorRate := int64(defaultBloomCapacity), defaultBloomErrorRate
+	if c.Bloom != nil && c.Bloom.Capacity > 0 {
+		capacity = c.Bloom.Capacity
+	}
+	if c.Bloom != nil && c.Bloom.ErrorRate > 0 && c.Bloom.ErrorRate < 1 {
+		errorRate = c.Bloom.ErrorRate
+	}
+	cache = &Cache{
+		Client:         rdb,
+		ProjectTTL:     durationOr(c.Redis.ProjectTtl, defaultProjectTTL),
+		PathTTL:        durationOr(c.Redis.PathTtl, defaultPathTTL),
+		NotFoundTTL:    durationOr(c.Redis.NotFoundTtl, defaultNotFoundTTL),
+		IdempotencyTTL: durationOr(c.Redis.IdempotencyTtl, defaultIdempotencyTTL),
+		names:          newProjectFilter(rdb, capacity, errorRate),
+	}
 	return
 }
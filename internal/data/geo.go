@@ -0,0 +1,216 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	v1 "project/api/project/v1"
+	"project/internal/ent"
+	"project/internal/ent/predicate"
+	"project/internal/ent/project"
+	"project/internal/ent/schema"
+
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+)
+
+// earthRadius is the mean radius of the Earth in meters, shared by the database and the in-process computations
+// so that both agree on which projects lie within a radius.
+const earthRadius = 6371000
+
+// toSchemaPoint converts the coordinate of the API into the point stored in the database.
+func toSchemaPoint(g *v1.GeoPoint) *schema.Point {
+	if g == nil {
+		return nil
+	}
+	return &schema.Point{Lat: g.Latitude, Lng: g.Longitude}
+}
+
+// toGeoPoint converts the point stored in the database into the coordinate of the API.
+func toGeoPoint(p *schema.Point) *v1.GeoPoint {
+	if p == nil {
+		return nil
+	}
+	return &v1.GeoPoint{Latitude: p.Lat, Longitude: p.Lng}
+}
+
+// toSchemaPolygon converts the boundary of the API into the polygon stored in the database.
+func toSchemaPolygon(g *v1.GeoPolygon) *schema.Polygon {
+	if g == nil {
+		return nil
+	}
+	polygon := &schema.Polygon{Points: make([]schema.Point, 0, len(g.Points))}
+	for _, point := range g.Points {
+		polygon.Points = append(polygon.Points, *toSchemaPoint(point))
+	}
+	return polygon
+}
+
+// toGeoPolygon converts the polygon stored in the database into the boundary of the API.
+// An absent or empty polygon leaves the boundary unset.
+func toGeoPolygon(p *schema.Polygon) *v1.GeoPolygon {
+	if p == nil || len(p.Points) == 0 {
+		return nil
+	}
+	polygon := &v1.GeoPolygon{Points: make([]*v1.GeoPoint, 0, len(p.Points))}
+	for i := range p.Points {
+		polygon.Points = append(polygon.Points, toGeoPoint(&p.Points[i]))
+	}
+	return polygon
+}
+
+// supportsSpatial reports whether the database evaluates spatial predicates itself.
+// Other databases store the coordinates as plain text and are filtered in the process instead.
+func (r *projectRepo) supportsSpatial() bool {
+	return r.db.Driver == dialect.MySQL || r.db.Driver == dialect.Postgres
+}
+
+// boundingBox returns the south-west and the north-east corners of the rectangle enclosing the circle of the given
+// radius in kilometers.
+//
+// The rectangle is only a coarse filter served by the spatial index, the exact distance is checked afterward.
+// It spans every longitude when the circle reaches a pole or goes around the Earth. A circle crossing the
+// antimeridian wraps around it, its west corner then lying east of its east corner, see [coordinateInBounds].
+func boundingBox(center *v1.GeoPoint, radius float64) (southWest, northEast *v1.GeoPoint) {
+	deltaLat := radius * 1000 / earthRadius * 180 / math.Pi
+	minLat, maxLat := math.Max(center.Latitude-deltaLat, -90), math.Min(center.Latitude+deltaLat, 90)
+	minLng, maxLng := -180.0, 180.0
+	if cos := math.Cos(center.Latitude * math.Pi / 180); minLat > -90 && maxLat < 90 && cos > 0 {
+		if deltaLng := deltaLat / cos; deltaLng < 180 {
+			minLng, maxLng = wrapLongitude(center.Longitude-deltaLng), wrapLongitude(center.Longitude+deltaLng)
+		}
+	}
+	return &v1.GeoPoint{Latitude: minLat, Longitude: minLng}, &v1.GeoPoint{Latitude: maxLat, Longitude: maxLng}
+}
+
+// wrapLongitude brings a longitude that went past the antimeridian back between -180 and 180.
+func wrapLongitude(lng float64) float64 {
+	switch {
+	case lng < -180:
+		return lng + 360
+	case lng > 180:
+		return lng - 360
+	}
+	return lng
+}
+
+// rectangle returns the WKT polygon of the rectangle between the south-west and the north-east corners.
+func rectangle(minLat, minLng, maxLat, maxLng float64) schema.WKT {
+	return schema.WKT(fmt.Sprintf(
+		"POLYGON((%[2]f %[1]f, %[4]f %[1]f, %[4]f %[3]f, %[2]f %[3]f, %[2]f %[1]f))",
+		minLat, minLng, maxLat, maxLng,
+	))
+}
+
+// writeDistance writes the expression computing the distance in meters between the coordinate column and the point.
+func writeDistance(b *sql.Builder, column string, point *schema.Point) {
+	switch b.Dialect() {
+	case dialect.Postgres:
+		b.WriteString("ST_DistanceSphere(").Ident(column).Comma().Arg(point).WriteString(")")
+	default:
+		b.WriteString("ST_Distance_Sphere(").Ident(column).Comma().Arg(point).Comma().Arg(earthRadius).WriteString(")")
+	}
+}
+
+// coordinateWithin matches the projects whose coordinate lies inside the given polygon.
+func coordinateWithin(polygon schema.WKT) predicate.Project {
+	return func(s *sql.Selector) {
+		s.Where(sql.P(func(b *sql.Builder) {
+			switch b.Dialect() {
+			case dialect.Postgres:
+				b.WriteString("ST_Within(").Ident(s.C(project.FieldCoordinate)).Comma().Arg(polygon).WriteString(")")
+			default:
+				b.WriteString("MBRContains(").Arg(polygon).Comma().Ident(s.C(project.FieldCoordinate)).WriteString(")")
+			}
+		}))
+	}
+}
+
+// coordinateInPolygon matches the projects whose coordinate lies inside the polygon.
+func coordinateInPolygon(polygon *schema.Polygon) predicate.Project {
+	return func(s *sql.Selector) {
+		s.Where(sql.P(func(b *sql.Builder) {
+			b.WriteString("ST_Contains(").Arg(polygon.WKT()).Comma().Ident(s.C(project.FieldCoordinate)).WriteString(")")
+		}))
+	}
+}
+
+// boundaryContains matches the projects whose boundary contains the point.
+// Projects without a boundary never match.
+func boundaryContains(point *schema.Point) predicate.Project {
+	return func(s *sql.Selector) {
+		s.Where(sql.P(func(b *sql.Builder) {
+			b.WriteString("ST_Contains(").Ident(s.C(project.FieldBoundary)).Comma().Arg(point).WriteString(")")
+		}))
+	}
+}
+
+// coordinateNear matches the projects whose coordinate lies within the radius in kilometers of the point.
+//
+// The bounding box of the circle is matched first so that the spatial index narrows the candidates down
+// before the exact spherical distance is computed.
+func coordinateNear(center *v1.GeoPoint, radius float64) predicate.Project {
+	return func(s *sql.Selector) {
+		coordinateInBounds(boundingBox(center, radius))(s)
+		s.Where(sql.P(func(b *sql.Builder) {
+			writeDistance(b, s.C(project.FieldCoordinate), toSchemaPoint(center))
+			b.WriteOp(sql.OpLTE).Arg(radius * 1000)
+		}))
+	}
+}
+
+// byDistance orders the projects from the nearest to the farthest from the point.
+func byDistance(center *v1.GeoPoint) project.OrderOption {
+	return func(s *sql.Selector) {
+		s.OrderExprFunc(func(b *sql.Builder) {
+			writeDistance(b, s.C(project.FieldCoordinate), toSchemaPoint(center))
+		})
+	}
+}
+
+// coordinateInBounds matches the projects whose coordinate lies inside the rectangle between the south-west and
+// the north-east corners. A rectangle crossing the antimeridian is split into two at the antimeridian.
+func coordinateInBounds(southWest, northEast *v1.GeoPoint) predicate.Project {
+	if southWest.Longitude <= northEast.Longitude {
+		return coordinateWithin(rectangle(southWest.Latitude, southWest.Longitude, northEast.Latitude, northEast.Longitude))
+	}
+	return project.Or(
+		coordinateWithin(rectangle(southWest.Latitude, southWest.Longitude, northEast.Latitude, 180)),
+		coordinateWithin(rectangle(southWest.Latitude, -180, northEast.Latitude, northEast.Longitude)),
+	)
+}
+
+// inBounds is the in-process counterpart of [coordinateInBounds].
+func inBounds(p *schema.Point, southWest, northEast *v1.GeoPoint) bool {
+	if p.Lat < southWest.Latitude || p.Lat > northEast.Latitude {
+		return false
+	}
+	if southWest.Longitude <= northEast.Longitude {
+		return p.Lng >= southWest.Longitude && p.Lng <= northEast.Longitude
+	}
+	return p.Lng >= southWest.Longitude || p.Lng <= northEast.Longitude
+}
+
+// liveInSubtree matches the projects that are not soft deleted and, unless rootId is empty, belong to the subtree
+// rooted at the project rootId. The path of the root is loaded first, so that the subtree is matched by the prefix
+// of the paths like [subtreeOf] does, which the index on the paths serves. Nothing matches a root that cannot be found.
+func (r *projectRepo) liveInSubtree(ctx context.Context, rootId string) ([]predicate.Project, error) {
+	if rootId == "" {
+		return []predicate.Project{project.Deleted(false)}, nil
+	}
+	root, err := r.query(ctx).
+		Where(project.ProjectID(rootId)).
+		Select(project.FieldProjectID, project.FieldPath).
+		First(ctx)
+	if ent.IsNotFound(err) {
+		return []predicate.Project{project.ProjectIDIn()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := subtreeOf(root)
+	if err != nil {
+		return nil, err
+	}
+	return []predicate.Project{project.Deleted(false), subtree}, nil
+}
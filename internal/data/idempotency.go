@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"project/internal/biz"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultIdempotencyTTL is how long the replies of the requests carrying idempotency keys are kept when the config
+// leaves it out
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// errIdempotencyClaimLost fails the writes of a request whose claim on its key expired, the key having possibly
+// been claimed by a retry since
+var errIdempotencyClaimLost = errors.New("the claim on the idempotency key expired")
+
+// idempotencyRepo implements the interface [biz.IdempotencyRepository] described in the package
+// [project/internal/biz] on top of the Redis cache.
+//
+// A claimed key holds the pending record of the request, which carries a random token, and the claim handed to the
+// request is that value itself. The writes of the request are then made by the scripts changing the key only while
+// it still holds the value, which no other request can have written.
+type idempotencyRepo struct {
+	cache *Cache
+}
+
+// NewIdempotencyRepository creates a new idempotency repository implementation instance and returns the interface
+// value.
+func NewIdempotencyRepository(cache *Cache) biz.IdempotencyRepository {
+	return &idempotencyRepo{cache: cache}
+}
+
+// idempotencyKey is the cache key of the request of the tenant carrying the idempotency key.
+func idempotencyKey(tenant, key string) string {
+	return "project:idempotency:" + tenantScoped(tenant, key)
+}
+
+// pendingRecord is the record of a request still running, which the token tells apart from the other requests
+// claiming the same key with the same payload.
+type pendingRecord struct {
+	biz.IdempotencyRecord
+	Token string
+}
+
+func (r *idempotencyRepo) Reserve(ctx context.Context, key, fingerprint string) (string, *biz.IdempotencyRecord, error) {
+	cacheKey := idempotencyKey(biz.TenantFromContext(ctx), key)
+	pending, err := json.Marshal(&pendingRecord{
+		IdempotencyRecord: biz.IdempotencyRecord{Fingerprint: fingerprint},
+		Token:             uuid.NewString(),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		claimed, err := r.cache.Client.SetNX(ctx, cacheKey, pending, biz.IdempotencyClaimTTL).Result()
+		if err != nil {
+			return "", nil, err
+		}
+		if claimed {
+			return string(pending), nil, nil
+		}
+		raw, err := r.cache.Client.Get(ctx, cacheKey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// The record expired in between, the key may be claimed again
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		record := &biz.IdempotencyRecord{}
+		if err = json.Unmarshal(raw, record); err != nil {
+			return "", nil, err
+		}
+		return "", record, nil
+	}
+}
+
+// claimed runs the script changing the key only while it is claimed by the request, and fails when it is not.
+func (r *idempotencyRepo) claimed(ctx context.Context, script *redis.Script, key, claim string, args ...interface{}) error {
+	changed, err := script.Run(ctx, r.cache.Client, []string{idempotencyKey(biz.TenantFromContext(ctx), key)},
+		append([]interface{}{claim}, args...)...).Int()
+	if err == nil && changed == 0 {
+		err = errIdempotencyClaimLost
+	}
+	return err
+}
+
+func (r *idempotencyRepo) Extend(ctx context.Context, key, claim string) error {
+	return r.claimed(ctx, compareAndExpire, key, claim, biz.IdempotencyClaimTTL.Milliseconds())
+}
+
+func (r *idempotencyRepo) Complete(ctx context.Context, key, claim string, record *biz.IdempotencyRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.claimed(ctx, compareAndSet, key, claim, raw, r.cache.IdempotencyTTL.Milliseconds())
+}
+
+func (r *idempotencyRepo) Release(ctx context.Context, key, claim string) error {
+	return r.claimed(ctx, compareAndDelete, key, claim)
+}
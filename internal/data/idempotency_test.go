@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"project/internal/biz"
+	"project/internal/conf"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestIdempotencyClaimIsKeptUntilItExpires(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache, cleanup, err := NewCache(&conf.Data{Redis: &conf.Data_Redis{Addr: server.Addr()}})
+	if err != nil {
+		t.Fatalf("failed to connect to Redis: %v", err)
+	}
+	t.Cleanup(cleanup)
+	repo := NewIdempotencyRepository(cache)
+	ctx := context.Background()
+
+	claim, _, err := repo.Reserve(ctx, "key", "payload")
+	if err != nil || claim == "" {
+		t.Fatalf("claiming the key: got %q, %v", claim, err)
+	}
+	// An extended claim outlives its first lifetime
+	server.FastForward(biz.IdempotencyClaimTTL * 2 / 3)
+	if err = repo.Extend(ctx, "key", claim); err != nil {
+		t.Fatalf("extending the claim: %v", err)
+	}
+	server.FastForward(biz.IdempotencyClaimTTL * 2 / 3)
+	if retry, record, err := repo.Reserve(ctx, "key", "payload"); err != nil || retry != "" || record == nil {
+		t.Fatalf("a retry while the claim is held: got %q, %v, %v, want the pending record", retry, record, err)
+	}
+
+	// Once the claim expires, a retry claims the key and the first request cannot write it anymore
+	server.FastForward(biz.IdempotencyClaimTTL)
+	retry, _, err := repo.Reserve(ctx, "key", "payload")
+	if err != nil || retry == "" || retry == claim {
+		t.Fatalf("a retry once the claim expired: got %q, %v, want a claim of its own", retry, err)
+	}
+	if err = repo.Complete(ctx, "key", claim, &biz.IdempotencyRecord{Fingerprint: "payload", Reply: []byte("first")}); err == nil {
+		t.Error("the request that lost its claim completed the key")
+	}
+	if err = repo.Release(ctx, "key", claim); err == nil {
+		t.Error("the request that lost its claim released the key")
+	}
+	if err = repo.Complete(ctx, "key", retry, &biz.IdempotencyRecord{Fingerprint: "payload", Reply: []byte("retry")}); err != nil {
+		t.Fatalf("completing the retry: %v", err)
+	}
+	if _, record, err := repo.Reserve(ctx, "key", "payload"); err != nil || record == nil || string(record.Reply) != "retry" {
+		t.Errorf("the stored reply: got %v, %v, want the reply of the retry", record, err)
+	}
+}
@@ -0,0 +1,313 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"project/internal/biz"
+	"project/internal/conf"
+	"project/internal/ent/project"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	etcdclient "go.etcd.io/etcd/client/v3"
+)
+
+// maxProjectIdLength is the length of the longest project ID allowed by the protocol buffers
+const maxProjectIdLength = 64
+
+// defaultWorkerKeyPrefix is the prefix of the etcd keys leasing the Snowflake worker IDs when the config leaves
+// it out
+const defaultWorkerKeyPrefix = "/project/snowflake/workers/"
+
+// The layout of the Snowflake IDs, which hold the milliseconds elapsed since [snowflakeEpoch], followed by the
+// worker ID of the instance and by a sequence number within the millisecond
+const (
+	snowflakeWorkerBits   = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+	// snowflakeLeaseTTL is the lifetime in seconds of the lease on the worker ID, which is kept alive while the
+	// instance runs
+	snowflakeLeaseTTL = 30
+	// snowflakeMaxRetryDelay bounds the delay between two attempts to lease another worker ID once the lease is lost
+	snowflakeMaxRetryDelay = 30 * time.Second
+)
+
+// snowflakeEpoch is the time the Snowflake IDs count from
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// slugRootPrefix starts the slugs of the root projects, which have no parent to derive them from
+const slugRootPrefix = "project"
+
+// crockford is the alphabet of the ULIDs, Crockford's base32
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewIdGenerator creates the generator of the project IDs following the configured strategy, ULIDs by default.
+//
+// The Snowflake generator leases its worker ID from etcd for as long as the application runs, so that the
+// instances never share a worker ID.
+func NewIdGenerator(c *conf.Data, database *Data, cache *Cache, etcd *etcdclient.Client) (gen biz.IdGenerator, cleanup func(), err error) {
+	cleanup = func() {}
+	switch strategy := c.GetIds().GetStrategy(); strategy {
+	case conf.Data_Ids_ULID:
+		gen = ulidGenerator{}
+	case conf.Data_Ids_UUIDv7:
+		gen = uuidGenerator{}
+	case conf.Data_Ids_Snowflake:
+		prefix := c.GetIds().GetWorkerKeyPrefix()
+		if prefix == "" {
+			prefix = defaultWorkerKeyPrefix
+		}
+		var g *snowflakeGenerator
+		if g, err = newSnowflakeGenerator(etcd, prefix); err != nil {
+			return nil, nil, err
+		}
+		gen, cleanup = g, g.release
+	case conf.Data_Ids_Slug:
+		gen = &slugGenerator{db: database, cache: cache}
+	default:
+		return nil, nil, fmt.Errorf("unknown project ID strategy %v", strategy)
+	}
+	return
+}
+
+// ulidGenerator generates ULIDs, which are sorted by their creation time.
+type ulidGenerator struct{}
+
+func (ulidGenerator) NewId(context.Context, *biz.Project) (string, error) {
+	// 48 bits of milliseconds since the Unix epoch followed by 80 random bits
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	// The 128 bits are encoded 5 at a time from the end, leaving the 3 leading bits to the first character
+	out := make([]byte, 26)
+	var acc, bits uint
+	j := len(out) - 1
+	for i := len(b) - 1; i >= 0; i-- {
+		acc |= uint(b[i]) << bits
+		for bits += 8; bits >= 5; bits -= 5 {
+			out[j] = crockford[acc&31]
+			acc >>= 5
+			j--
+		}
+	}
+	out[0] = crockford[acc&31]
+	return string(out), nil
+}
+
+// uuidGenerator generates version 7 UUIDs, which are sorted by their creation time.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewId(context.Context, *biz.Project) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// snowflakeGenerator generates Snowflake IDs, which are decimal numbers sorted by their creation time.
+type snowflakeGenerator struct {
+	client *etcdclient.Client
+	prefix string
+	stop   context.CancelFunc
+	// done is closed once the lease is not kept alive anymore
+	done chan struct{}
+
+	mu sync.Mutex
+	// lease is the lease on the worker ID, worker is -1 while the instance leases none
+	lease  etcdclient.LeaseID
+	worker int64
+	// last is the millisecond of the last ID, and seq its sequence number within that millisecond
+	last int64
+	seq  int64
+}
+
+// newSnowflakeGenerator leases the first worker ID free in etcd, and keeps the lease alive in the background.
+func newSnowflakeGenerator(client *etcdclient.Client, prefix string) (*snowflakeGenerator, error) {
+	ctx, stop := context.WithCancel(context.Background())
+	g := &snowflakeGenerator{client: client, prefix: prefix, stop: stop, done: make(chan struct{}), worker: -1}
+	alive, err := g.acquire(ctx)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	go g.keepAlive(ctx, alive)
+	return g, nil
+}
+
+// acquire leases the first worker ID free in etcd and returns the responses keeping the lease alive, whose channel
+// is closed once the lease cannot be kept alive anymore.
+func (g *snowflakeGenerator) acquire(ctx context.Context) (<-chan *etcdclient.LeaseKeepAliveResponse, error) {
+	lease, err := g.client.Grant(ctx, snowflakeLeaseTTL)
+	if err != nil {
+		return nil, err
+	}
+	// The lease is revoked with a context of its own, since acquire also fails when its context is cancelled
+	revoke := func() { _, _ = g.client.Revoke(context.WithoutCancel(ctx), lease.ID) }
+	host, _ := os.Hostname()
+	worker := int64(-1)
+	for w := int64(0); w < 1<<snowflakeWorkerBits && worker < 0; w++ {
+		key := g.prefix + strconv.FormatInt(w, 10)
+		resp, err := g.client.Txn(ctx).
+			If(etcdclient.Compare(etcdclient.CreateRevision(key), "=", 0)).
+			Then(etcdclient.OpPut(key, host, etcdclient.WithLease(lease.ID))).
+			Commit()
+		if err != nil {
+			revoke()
+			return nil, err
+		}
+		if resp.Succeeded {
+			worker = w
+		}
+	}
+	if worker < 0 {
+		revoke()
+		return nil, errors.New("every Snowflake worker ID is leased by another instance")
+	}
+	alive, err := g.client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		revoke()
+		return nil, err
+	}
+
+	g.mu.Lock()
+	g.lease, g.worker = lease.ID, worker
+	g.mu.Unlock()
+	log.Infof("leased the Snowflake worker ID %d", worker)
+	return alive, nil
+}
+
+// keepAlive keeps the lease on the worker ID alive until the generator is released. Once the lease is lost, such as
+// when etcd stayed unreachable for longer than its lifetime, another instance may lease the worker ID, so no ID is
+// generated until another worker ID is leased, which is tried again with a growing delay until it succeeds.
+func (g *snowflakeGenerator) keepAlive(ctx context.Context, alive <-chan *etcdclient.LeaseKeepAliveResponse) {
+	defer close(g.done)
+	for {
+		for range alive {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		g.mu.Lock()
+		lost := g.lease
+		log.Warnf("lost the lease on the Snowflake worker ID %d, leasing another one", g.worker)
+		g.worker = -1
+		g.mu.Unlock()
+		// The lease may still be there when only its keep-alive failed, it then frees its worker ID right away.
+		// Past its lifetime, the lease has expired anyway, so an unreachable etcd does not delay the next lease.
+		revokeCtx, cancel := context.WithTimeout(ctx, snowflakeLeaseTTL*time.Second)
+		_, _ = g.client.Revoke(revokeCtx, lost)
+		cancel()
+
+		for delay := time.Second; ; delay = min(2*delay, snowflakeMaxRetryDelay) {
+			var err error
+			if alive, err = g.acquire(ctx); err == nil {
+				break
+			}
+			log.Warnf("failed to lease a Snowflake worker ID: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+func (g *snowflakeGenerator) NewId(context.Context, *biz.Project) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Another instance may lease the worker ID once the lease expires
+	if g.worker < 0 {
+		return "", errors.New("the lease on the Snowflake worker ID is lost, another worker ID is being leased")
+	}
+
+	// A clock moving backwards keeps counting from the last millisecond rather than reusing the IDs
+	now := max(time.Since(snowflakeEpoch).Milliseconds(), g.last)
+	if now == g.last {
+		if g.seq++; g.seq > snowflakeMaxSequence {
+			// The sequence is exhausted, the next ID waits for the next millisecond
+			for now <= g.last {
+				time.Sleep(time.Millisecond)
+				now = time.Since(snowflakeEpoch).Milliseconds()
+			}
+			g.seq = 0
+		}
+	} else {
+		g.seq = 0
+	}
+	g.last = now
+	id := now<<(snowflakeWorkerBits+snowflakeSequenceBits) | g.worker<<snowflakeSequenceBits | g.seq
+	return strconv.FormatInt(id, 10), nil
+}
+
+// release gives the worker ID back, so that another instance may lease it right away.
+func (g *snowflakeGenerator) release() {
+	g.stop()
+	<-g.done
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.worker < 0 {
+		return
+	}
+	if _, err := g.client.Revoke(context.Background(), g.lease); err != nil {
+		log.Warnf("failed to release the Snowflake worker ID %d: %v", g.worker, err)
+	}
+}
+
+// slugGenerator derives the IDs from the IDs of the parents followed by a sequence number, such as `site-a-3` for
+// the third child of `site-a`, the root projects being numbered after [slugRootPrefix].
+//
+// The sequences live in Redis. A sequence lost by Redis starts over after the number of children of the parent,
+// while the IDs still taken are skipped by [biz.ProjectManager.Add].
+type slugGenerator struct {
+	db    *Data
+	cache *Cache
+}
+
+// slugSequenceKey is the cache key of the sequence numbering the children of the parent of the tenant.
+func slugSequenceKey(tenant, parent string) string {
+	return "project:slug:" + tenantScoped(tenant, parent)
+}
+
+func (g *slugGenerator) NewId(ctx context.Context, p *biz.Project) (string, error) {
+	prefix := p.ParentProjId
+	if prefix == "" {
+		prefix = slugRootPrefix
+	}
+	key := slugSequenceKey(biz.TenantFromContext(ctx), prefix)
+	seq, err := g.cache.Client.Incr(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	if seq == 1 {
+		children, err := g.db.DB(ctx).Project.Query().
+			Where(ofTenant(ctx), project.ParentProjID(p.ParentProjId)).
+			Count(ctx)
+		if err != nil {
+			return "", err
+		}
+		if children > 0 {
+			if seq, err = g.cache.Client.IncrBy(ctx, key, int64(children)).Result(); err != nil {
+				return "", err
+			}
+		}
+	}
+	// The parent is cut short when the ID would be too long
+	suffix := "-" + strconv.FormatInt(seq, 10)
+	if len(prefix)+len(suffix) > maxProjectIdLength {
+		prefix = prefix[:maxProjectIdLength-len(suffix)]
+	}
+	return prefix + suffix, nil
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/ent"
+	"project/internal/ent/membership"
+	"project/internal/ent/predicate"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// membershipRepo implements the interface [biz.MembershipRepository] described in the package [project/internal/biz].
+type membershipRepo struct {
+	db *Data
+}
+
+// NewMembershipRepository creates a new membership repository implementation instance and returns the interface value.
+func NewMembershipRepository(database *Data) biz.MembershipRepository {
+	return &membershipRepo{db: database}
+}
+
+// The values of the enums of the entity for the enums of the messages
+var (
+	principalTypes = map[v1.PrincipalType]membership.PrincipalType{
+		v1.PrincipalType_PRINCIPAL_TYPE_USER:  membership.PrincipalTypeUser,
+		v1.PrincipalType_PRINCIPAL_TYPE_GROUP: membership.PrincipalTypeGroup,
+	}
+	roles = map[v1.Role]membership.Role{
+		v1.Role_ROLE_VIEWER: membership.RoleViewer,
+		v1.Role_ROLE_EDITOR: membership.RoleEditor,
+		v1.Role_ROLE_ADMIN:  membership.RoleAdmin,
+	}
+)
+
+// Helper function to convert from ent.Membership to biz.Membership
+func convertToBizMembership(ms *ent.Membership) *biz.Membership {
+	m := &biz.Membership{
+		PrincipalId: ms.PrincipalID,
+		ProjectId:   ms.ProjectID,
+		GrantedBy:   ms.GrantedBy,
+		CreateTime:  timestamppb.New(ms.CreateTime),
+	}
+	for t, value := range principalTypes {
+		if value == ms.PrincipalType {
+			m.PrincipalType = t
+		}
+	}
+	for r, value := range roles {
+		if value == ms.Role {
+			m.Role = r
+		}
+	}
+	return m
+}
+
+// query starts a query on the memberships of the tenant of the request, see [ofTenant].
+func (r *membershipRepo) query(ctx context.Context) *ent.MembershipQuery {
+	return r.db.DB(ctx).Membership.Query().Where(membership.TenantID(biz.TenantFromContext(ctx)))
+}
+
+// isPrincipal matches the memberships of the principal.
+func isPrincipal(principal biz.Principal) predicate.Membership {
+	return membership.And(
+		membership.PrincipalTypeEQ(principalTypes[principal.Type]),
+		membership.PrincipalID(principal.Id),
+	)
+}
+
+// Grant creates the membership, or replaces the role of the principal when it already holds one on the project.
+func (r *membershipRepo) Grant(ctx context.Context, m *biz.Membership) (granted *biz.Membership, err error) {
+	err = r.db.InTx(ctx, func(ctx context.Context) error {
+		principal := biz.Principal{Type: m.PrincipalType, Id: m.PrincipalId}
+		existing, err := r.query(ctx).
+			Where(isPrincipal(principal), membership.ProjectID(m.ProjectId)).
+			First(ctx)
+		var ms *ent.Membership
+		switch {
+		case ent.IsNotFound(err):
+			ms, err = r.db.DB(ctx).Membership.Create().
+				SetTenantID(biz.TenantFromContext(ctx)).
+				SetPrincipalType(principalTypes[m.PrincipalType]).
+				SetPrincipalID(m.PrincipalId).
+				SetProjectID(m.ProjectId).
+				SetRole(roles[m.Role]).
+				SetGrantedBy(m.GrantedBy).
+				Save(ctx)
+		case err == nil:
+			ms, err = r.db.DB(ctx).Membership.UpdateOne(existing).
+				SetRole(roles[m.Role]).
+				SetGrantedBy(m.GrantedBy).
+				Save(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		granted = convertToBizMembership(ms)
+		return nil
+	})
+	return
+}
+
+// Revoke deletes the membership of the principal on the project and reports whether there was one.
+func (r *membershipRepo) Revoke(ctx context.Context, projectId string, principal biz.Principal) (bool, error) {
+	deleted, err := r.db.DB(ctx).Membership.Delete().
+		Where(membership.TenantID(biz.TenantFromContext(ctx)), isPrincipal(principal), membership.ProjectID(projectId)).
+		Exec(ctx)
+	return deleted > 0, err
+}
+
+// FindByProjects retrieves the memberships granted on any of the projects.
+func (r *membershipRepo) FindByProjects(ctx context.Context, projectIds []string) ([]*biz.Membership, error) {
+	memberships, err := r.query(ctx).
+		Where(membership.ProjectIDIn(projectIds...)).
+		Order(ent.Asc(membership.FieldPrincipalType), ent.Asc(membership.FieldPrincipalID)).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertToBizMemberships(memberships), nil
+}
+
+// FindByPrincipals retrieves the memberships granted to any of the principals.
+func (r *membershipRepo) FindByPrincipals(ctx context.Context, principals []biz.Principal) ([]*biz.Membership, error) {
+	matches := make([]predicate.Membership, 0, len(principals))
+	for _, principal := range principals {
+		matches = append(matches, isPrincipal(principal))
+	}
+	memberships, err := r.query(ctx).Where(membership.Or(matches...)).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertToBizMemberships(memberships), nil
+}
+
+func convertToBizMemberships(memberships []*ent.Membership) []*biz.Membership {
+	bizMemberships := make([]*biz.Membership, 0, len(memberships))
+	for _, ms := range memberships {
+		bizMemberships = append(bizMemberships, convertToBizMembership(ms))
+	}
+	return bizMemberships
+}
@@ -0,0 +1,293 @@
+package data
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"project/internal/ent"
+	"project/internal/ent/datamigration"
+	"project/internal/ent/project"
+	"project/internal/ent/projectrevision"
+	"project/internal/ent/schema"
+	"time"
+
+	"entgo.io/ent/dialect"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dataMigration fills in the stored data that a change of the schema alone cannot, such as a column computed from
+// the other columns of the rows stored before it was added.
+type dataMigration struct {
+	name  string
+	apply func(ctx context.Context, client *ent.Client) error
+}
+
+// dataMigrations are applied in order by [Data.Migrate], each of them once per database.
+var dataMigrations = []dataMigration{
+	{name: "project-paths", apply: backfillProjectPaths},
+	{name: "project-revisions", apply: seedProjectRevisions},
+}
+
+// seedRevisionsBatch is the number of projects read from the db at once while seeding their revisions
+const seedRevisionsBatch = 1000
+
+// Migrate brings the database up to date with the application before it serves any request.
+//
+// The schema is created or altered first, once the stored data it cannot convert by itself is converted, then the
+// data migrations not applied yet run in order, each in its own transaction which records it in the table
+// data_migrations. When several instances start together, the first one applies a data migration while the others
+// wait for its record and skip it.
+func (d *Data) Migrate(ctx context.Context) error {
+	if err := d.convertCoordinates(ctx); err != nil {
+		return fmt.Errorf("converting the coordinates: %w", err)
+	}
+	if err := d.Client.Schema.Create(ctx); err != nil {
+		return fmt.Errorf("migrating the schema: %w", err)
+	}
+	for _, m := range dataMigrations {
+		if err := d.applyOnce(ctx, m); err != nil {
+			return fmt.Errorf("applying the data migration %v: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// convertCoordinates restricts the coordinates of the projects to the SRID 4326, the column having been created
+// without any SRID before the spatial index needed one.
+//
+// MySQL refuses to restrict a column holding geometries of another SRID, so the schema migration cannot do it
+// alone. The geometries are stored longitude first whatever their SRID, hence assigning them the SRID keeps their
+// coordinates. Columns already restricted, tables not created yet and other databases are left untouched.
+func (d *Data) convertCoordinates(ctx context.Context) error {
+	if d.Driver != dialect.MySQL {
+		return nil
+	}
+	rows, err := d.Client.QueryContext(ctx,
+		"SELECT SRS_ID FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		project.Table, project.FieldCoordinate,
+	)
+	if err != nil {
+		return err
+	}
+	var srid stdsql.NullInt64
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&srid)
+	}
+	if cerr := rows.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !found || srid.Int64 == schema.SRID {
+		return err
+	}
+
+	log.Infof("restricting the coordinates of the projects to the SRID %d", schema.SRID)
+	if _, err = d.Client.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE `%[1]s` SET `%[2]s` = ST_SRID(`%[2]s`, %[3]d) WHERE ST_SRID(`%[2]s`) <> %[3]d",
+		project.Table, project.FieldCoordinate, schema.SRID,
+	)); err != nil {
+		return err
+	}
+	_, err = d.Client.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE `%s` MODIFY `%s` POINT NOT NULL SRID %d",
+		project.Table, project.FieldCoordinate, schema.SRID,
+	))
+	return err
+}
+
+// applyOnce applies the data migration unless it has already been applied.
+func (d *Data) applyOnce(ctx context.Context, m dataMigration) error {
+	applied := func(ctx context.Context) (bool, error) {
+		return d.Client.DataMigration.Query().Where(datamigration.Name(m.name)).Exist(ctx)
+	}
+	if done, err := applied(ctx); err != nil || done {
+		return err
+	}
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		// The record is written first, so that another instance applying the same migration waits for this
+		// transaction and then fails on the duplicate name
+		if err := d.DB(ctx).DataMigration.Create().SetName(m.name).Exec(ctx); err != nil {
+			return err
+		}
+		log.Infof("applying the data migration %v", m.name)
+		return m.apply(ctx, d.DB(ctx))
+	})
+	if err != nil {
+		// Another instance applied it meanwhile
+		if done, _ := applied(ctx); done {
+			return nil
+		}
+	}
+	return err
+}
+
+// backfillProjectPaths computes the materialized paths and the depths of the projects from their parents, which
+// the projects stored before the paths were introduced lack.
+//
+// Every path is computed again rather than only the empty ones, which also mends the paths of the projects created
+// under such projects in the meantime. A project whose parent cannot be found, or whose ancestors form a cycle,
+// starts a path of its own as a root does.
+func backfillProjectPaths(ctx context.Context, client *ent.Client) error {
+	projects, err := client.Project.Query().
+		Select(
+			project.FieldID, project.FieldTenantID, project.FieldProjectID, project.FieldParentProjID,
+			project.FieldPath, project.FieldDepth, project.FieldLastUpdate,
+		).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	byId := make(map[string]*ent.Project, len(projects))
+	for _, p := range projects {
+		byId[tenantScoped(p.TenantID, p.ProjectID)] = p
+	}
+
+	type location struct {
+		path  string
+		depth int
+	}
+	locations := make(map[*ent.Project]location, len(projects))
+	for _, p := range projects {
+		// The ancestors whose paths are not computed yet are gathered from the project upwards
+		var chain []*ent.Project
+		onChain := make(map[*ent.Project]bool)
+		var top location
+		for current := p; ; {
+			if loc, ok := locations[current]; ok {
+				top = loc
+				break
+			}
+			chain = append(chain, current)
+			onChain[current] = true
+			if current.ParentProjID == "" {
+				break
+			}
+			parent, ok := byId[tenantScoped(current.TenantID, current.ParentProjID)]
+			if !ok || onChain[parent] {
+				log.Warnf("cannot reach the root of the project %v of the tenant %q, it starts a path of its own",
+					current.ProjectID, current.TenantID)
+				break
+			}
+			current = parent
+		}
+		// Then their paths are computed downwards, extending the path found above them if any
+		for i := len(chain) - 1; i >= 0; i-- {
+			id := chain[i].ProjectID
+			if top.path == "" {
+				top = location{path: projectPathSeparator + id + projectPathSeparator}
+			} else {
+				top = location{path: top.path + id + projectPathSeparator, depth: top.depth + 1}
+			}
+			locations[chain[i]] = top
+		}
+	}
+
+	updated := 0
+	for _, p := range projects {
+		loc := locations[p]
+		if loc.path == p.Path && loc.depth == p.Depth {
+			continue
+		}
+		// The path is not a change of the project, so neither its version nor its update time move
+		if err = client.Project.UpdateOneID(p.ID).
+			SetPath(loc.path).
+			SetDepth(loc.depth).
+			SetLastUpdate(p.LastUpdate).
+			Exec(ctx); err != nil {
+			return err
+		}
+		updated++
+	}
+	log.Infof("computed the paths of %d projects", updated)
+	return nil
+}
+
+// seedProjectRevisions starts the revision history of the projects stored before it was introduced, so that they
+// can be read as of a time before their next change.
+//
+// The changes made before the history are unknown, so the first revision holds the state of the project at the
+// time of the migration, dated back to its creation. A project in the trash gets a second revision, dated at its
+// deletion, so that it is only reported as deleted from then on. Projects that already have revisions are skipped.
+func seedProjectRevisions(ctx context.Context, client *ent.Client) error {
+	var revised []struct {
+		TenantID  string `json:"tenant_id"`
+		ProjectID string `json:"project_id"`
+	}
+	if err := client.ProjectRevision.Query().
+		Unique(true).
+		Select(projectrevision.FieldTenantID, projectrevision.FieldProjectID).
+		Scan(ctx, &revised); err != nil {
+		return err
+	}
+	skipped := make(map[string]bool, len(revised))
+	for _, r := range revised {
+		skipped[tenantScoped(r.TenantID, r.ProjectID)] = true
+	}
+
+	seeded, lastId := 0, 0
+	for {
+		projects, err := client.Project.Query().
+			Where(project.IDGT(lastId)).
+			Order(ent.Asc(project.FieldID)).
+			Limit(seedRevisionsBatch).
+			All(ctx)
+		if err != nil {
+			return err
+		}
+		if len(projects) == 0 {
+			break
+		}
+		lastId = projects[len(projects)-1].ID
+
+		builders := make([]*ent.ProjectRevisionCreate, 0, len(projects))
+		for _, p := range projects {
+			if skipped[tenantScoped(p.TenantID, p.ProjectID)] {
+				continue
+			}
+			proj, err := convertToBizProject(p)
+			if err != nil {
+				return err
+			}
+			revision := func(number int64, operation projectrevision.Operation, at time.Time) error {
+				snapshot, err := protojson.Marshal(proj)
+				if err != nil {
+					return err
+				}
+				builders = append(builders, client.ProjectRevision.Create().
+					SetTenantID(p.TenantID).
+					SetProjectID(p.ProjectID).
+					SetRevision(number).
+					SetSnapshot(string(snapshot)).
+					SetOperation(operation).
+					SetCreateTime(at))
+				return nil
+			}
+			proj.DeleteTime = nil
+			if err = revision(1, projectrevision.OperationCreate, p.CreateTime); err != nil {
+				return err
+			}
+			if p.Deleted {
+				// Projects deleted before the deletion times were introduced are dated at their last update
+				deletedAt := p.LastUpdate
+				if p.DeletedAt != nil {
+					deletedAt = *p.DeletedAt
+				}
+				proj.DeleteTime = timestamppb.New(deletedAt)
+				if err = revision(2, projectrevision.OperationDelete, deletedAt); err != nil {
+					return err
+				}
+			}
+			seeded++
+		}
+		if len(builders) > 0 {
+			if err = client.ProjectRevision.CreateBulk(builders...).Exec(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	log.Infof("seeded the revisions of %d projects", seeded)
+	return nil
+}
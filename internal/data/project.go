@@ -2,11 +2,24 @@ package data
 
 import (
 	"context"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"fmt"
 	"github.com/jinzhu/copier"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"math"
 	v1 "project/api/project/v1"
 	"project/internal/biz"
 	"project/internal/ent"
+	"project/internal/ent/membership"
+	"project/internal/ent/predicate"
+	"project/internal/ent/project"
+	"project/internal/ent/projectrevision"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // projectRepo implements the interface [biz.ProjectRepository] described in the package [project/internal/biz].
@@ -20,145 +33,830 @@ func NewProjectRepository(database *Data, cache *Cache) biz.ProjectRepository {
 	return &projectRepo{db: database, cache: cache}
 }
 
+// projectPathSeparator separates the project IDs in the materialized path of a project.
+// The path always starts and ends with the separator, so that matching "/id/" never hits a partial ID.
+const projectPathSeparator = "/"
+
+// splitProjectPath returns the IDs of the projects on a materialized path from the root down to the last one.
+func splitProjectPath(path string) []string {
+	return strings.Split(strings.Trim(path, projectPathSeparator), projectPathSeparator)
+}
+
+// tenantScoped qualifies the project ID with its tenant, for the cache keys and the Bloom filter items shared
+// by all the tenants. The IDs of the default tenant are left as they are.
+func tenantScoped(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + projectPathSeparator + id
+}
+
+// ofTenant matches the projects of the tenant of the request, see [biz.TenantFromContext].
+// Project IDs and paths are only unique within a tenant, so every query on the projects is scoped by it.
+func ofTenant(ctx context.Context) predicate.Project {
+	return project.TenantID(biz.TenantFromContext(ctx))
+}
+
+// errMissingPath is the error of a project stored before the paths were introduced, whose path is empty until the
+// data migration computing the paths runs, see [backfillProjectPaths]. Such a path is an error rather than the
+// empty prefix matching every project, or the root of no project at all.
+func errMissingPath(id string) error {
+	return fmt.Errorf("the project %v has no materialized path yet", id)
+}
+
+// subtreeOf matches the project and its descendants by the prefix of their materialized paths.
+func subtreeOf(proj *ent.Project) (predicate.Project, error) {
+	if proj.Path == "" {
+		return nil, errMissingPath(proj.ProjectID)
+	}
+	return project.PathHasPrefix(proj.Path), nil
+}
+
+// query starts a query on the projects of the tenant of the request.
+func (r *projectRepo) query(ctx context.Context) *ent.ProjectQuery {
+	return r.db.DB(ctx).Project.Query().Where(ofTenant(ctx))
+}
+
+// forUpdate locks the rows read by the query until the end of the transaction. SQLite has no row locks, since its
+// transactions write one at a time anyway.
+func (r *projectRepo) forUpdate(query *ent.ProjectQuery) *ent.ProjectQuery {
+	if r.db.Driver == dialect.SQLite {
+		return query
+	}
+	return query.ForUpdate()
+}
+
+// visibleToCaller restricts a query to the subtrees the caller may see, see [biz.VisibleRootsFromContext].
+// Nothing is restricted for callers who may see every project.
+//
+// The paths of the roots are loaded first, so that the subtrees are matched by the prefix of the paths, which the
+// index on the paths serves, rather than by looking for the roots anywhere in the paths.
+func (r *projectRepo) visibleToCaller(ctx context.Context) ([]predicate.Project, error) {
+	roots, restricted := biz.VisibleRootsFromContext(ctx)
+	if !restricted {
+		return nil, nil
+	}
+	projects, err := r.query(ctx).
+		Where(project.ProjectIDIn(roots...)).
+		Select(project.FieldProjectID, project.FieldPath).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Without any root, no project matches at all
+	if len(projects) == 0 {
+		return []predicate.Project{project.ProjectIDIn()}, nil
+	}
+	subtrees := make([]predicate.Project, 0, len(projects))
+	for _, p := range projects {
+		subtree, err := subtreeOf(p)
+		if err != nil {
+			return nil, err
+		}
+		subtrees = append(subtrees, subtree)
+	}
+	return []predicate.Project{project.Or(subtrees...)}, nil
+}
+
 // Helper function to convert from ent.Project to biz.Project
 func convertToBizProject(p *ent.Project) (proj *biz.Project, err error) {
 	proj = &biz.Project{}
 	if err = copier.Copy(proj, p); err != nil {
 		return
 	}
-	// Remove fields that shouldn't be exposed
-	proj.CreateTime = p.CreateTime.Format("2006-01-02 15:04:05")
-	proj.LastUpdate = p.LastUpdate.Format("2006-01-02 15:04:05")
+	// Fields whose types differ between the entity and the message are converted by hand
+	proj.Coordinate = toGeoPoint(p.Coordinate)
+	proj.Boundary = toGeoPolygon(p.Boundary)
+	proj.CreateTime = timestamppb.New(p.CreateTime)
+	proj.LastUpdate = timestamppb.New(p.LastUpdate)
+	if p.DeletedAt != nil {
+		proj.DeleteTime = timestamppb.New(*p.DeletedAt)
+	}
+	proj.Etag = formatEtag(p.Version)
 	return
 }
 
+// formatEtag returns the entity tag of a version of a project, which is a strong entity tag of HTTP (RFC 9110).
+func formatEtag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// expectedVersion returns the condition that the project is still at the version the entity tag was issued for.
+// An empty entity tag sets no condition, while weak entity tags and tags without quotes are accepted as well.
+func expectedVersion(etag string) ([]predicate.Project, error) {
+	if etag == "" {
+		return nil, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), 10, 64)
+	if err != nil {
+		return nil, v1.ErrorMalformedInput("Malformed entity tag %v", etag)
+	}
+	return []predicate.Project{project.Version(version)}, nil
+}
+
+// errStaleEtag is the error of a write conditioned on an entity tag that no longer matches the project.
+func errStaleEtag(p *biz.Project) error {
+	return v1.ErrorConflict("The project %v was changed since its entity tag %v was issued", p.ProjectId, p.Etag)
+}
+
+// errMissingCoordinate refuses to write a project without a coordinate, which every project has. The protocol
+// buffers require it, but the projects written by the service itself, such as the imported ones, skip their rules.
+func errMissingCoordinate(id string) error {
+	return v1.ErrorMalformedInput("The project %v has no coordinate", id)
+}
+
 // Add creates a new project and saves it to the database.
 func (r *projectRepo) Add(ctx context.Context, p *biz.Project) (err error) {
-	// Check if parent project exists if parentProjId is provided
-	if p.ParentProjID != "" {
-		var parentExists bool
-		if parentExists, err = r.db.Client.Project.Query().
-			Where(project.ProjectID(p.ParentProjID)).
-			Exist(ctx); err != nil {
+	if p.Coordinate == nil {
+		return errMissingCoordinate(p.ProjectId)
+	}
+	// A root project starts a new path, while other projects extend the path of their parents
+	path, depth := projectPathSeparator+p.ProjectId+projectPathSeparator, 0
+	if p.ParentProjId != "" {
+		var parent *ent.Project
+		if parent, err = r.query(ctx).
+			Where(project.ProjectID(p.ParentProjId), project.Deleted(false)).
+			First(ctx); err != nil {
+			if ent.IsNotFound(err) {
+				return v1.ErrorProjectNotFound("Parent project not found")
+			}
 			return err
 		}
-		if !parentExists {
-			return v1.ErrorProjectNotFound("Parent project not found")
+		if parent.Path == "" {
+			return errMissingPath(parent.ProjectID)
 		}
+		path, depth = parent.Path+p.ProjectId+projectPathSeparator, parent.Depth+1
 	}
 
 	// Create new project in the database
-	_, err = r.db.Client.Project.Create().
-		SetProjectID(p.ProjectID).
-		SetParentProjID(p.ParentProjID).
+	create := r.db.DB(ctx).Project.Create().
+		SetTenantID(biz.TenantFromContext(ctx)).
+		SetProjectID(p.ProjectId).
+		SetParentProjID(p.ParentProjId).
+		SetPath(path).
+		SetDepth(depth).
 		SetDesc(p.Desc).
 		SetLocation(p.Location).
-		SetCoordinate(p.Coordinate).
-		Save(ctx)
+		SetCoordinate(toSchemaPoint(p.Coordinate))
+	if p.Boundary != nil {
+		create.SetBoundary(toSchemaPolygon(p.Boundary))
+	}
+	_, err = create.Save(ctx)
 	if err == nil {
 		// Cache the project name to avoid duplicate entries
-		r.cache.Client.BFAdd(ctx, "project:names", p.ProjectID)
+		r.cache.names.add(ctx, tenantScoped(biz.TenantFromContext(ctx), p.ProjectId))
+		// The project may have been cached as absent
+		r.invalidate(ctx, p.ProjectId)
 	}
 	return
 }
 
+// AddBulk creates the projects with a single statement, marked as written by the bulk import when importId is set.
+// The parent of every project is either a live project already stored or a project coming earlier in the slice.
+func (r *projectRepo) AddBulk(ctx context.Context, projects []*biz.Project, importId string) error {
+	type location struct {
+		path  string
+		depth int
+	}
+	locations := make(map[string]location, len(projects))
+	var parents []string
+	for _, p := range projects {
+		locations[p.ProjectId] = location{}
+	}
+	for _, p := range projects {
+		if _, ok := locations[p.ParentProjId]; p.ParentProjId != "" && !ok {
+			parents = append(parents, p.ParentProjId)
+		}
+	}
+	stored, err := r.query(ctx).
+		Where(project.ProjectIDIn(parents...), project.Deleted(false)).
+		Select(project.FieldProjectID, project.FieldPath, project.FieldDepth).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range stored {
+		locations[p.ProjectID] = location{path: p.Path, depth: p.Depth}
+	}
+
+	tenant := biz.TenantFromContext(ctx)
+	builders := make([]*ent.ProjectCreate, 0, len(projects))
+	ids := make([]string, 0, len(projects))
+	for _, p := range projects {
+		if p.Coordinate == nil {
+			return errMissingCoordinate(p.ProjectId)
+		}
+		// A root project starts a new path, while other projects extend the path of their parents
+		loc := location{path: projectPathSeparator + p.ProjectId + projectPathSeparator}
+		if p.ParentProjId != "" {
+			parent := locations[p.ParentProjId]
+			if parent.path == "" {
+				return v1.ErrorInvalidParent("Cannot find the parent project with id %v", p.ParentProjId)
+			}
+			loc = location{path: parent.path + p.ProjectId + projectPathSeparator, depth: parent.depth + 1}
+		}
+		locations[p.ProjectId] = loc
+
+		create := r.db.DB(ctx).Project.Create().
+			SetTenantID(tenant).
+			SetProjectID(p.ProjectId).
+			SetParentProjID(p.ParentProjId).
+			SetPath(loc.path).
+			SetDepth(loc.depth).
+			SetDesc(p.Desc).
+			SetLocation(p.Location).
+			SetCoordinate(toSchemaPoint(p.Coordinate))
+		if p.Boundary != nil {
+			create.SetBoundary(toSchemaPolygon(p.Boundary))
+		}
+		if importId != "" {
+			create.SetImportID(importId)
+		}
+		builders = append(builders, create)
+		ids = append(ids, p.ProjectId)
+	}
+	if err = r.db.DB(ctx).Project.CreateBulk(builders...).Exec(ctx); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		r.cache.names.add(ctx, tenantScoped(tenant, id))
+	}
+	// The projects may have been cached as absent
+	r.invalidate(ctx, ids...)
+	return nil
+}
+
+// FindByIds retrieves the projects with the IDs, whether they are soft deleted or not, in no particular order.
+func (r *projectRepo) FindByIds(ctx context.Context, ids []string) ([]*biz.Project, error) {
+	ps, err := r.query(ctx).Where(project.ProjectIDIn(ids...)).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]*biz.Project, 0, len(ps))
+	for _, p := range ps {
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, proj)
+	}
+	return projects, nil
+}
+
+// FindImportedIds returns the IDs among the given ones of the projects last written by the bulk import.
+func (r *projectRepo) FindImportedIds(ctx context.Context, importId string, ids []string) ([]string, error) {
+	return r.query(ctx).
+		Where(project.ProjectIDIn(ids...), project.ImportID(importId)).
+		Select(project.FieldProjectID).
+		Strings(ctx)
+}
+
+// MarkImported records that the projects were last written by the bulk import. The mark is not a change of the
+// projects, so their versions are left untouched.
+func (r *projectRepo) MarkImported(ctx context.Context, importId string, ids []string) error {
+	return r.db.DB(ctx).Project.Update().
+		Where(ofTenant(ctx), project.ProjectIDIn(ids...)).
+		SetImportID(importId).
+		Exec(ctx)
+}
+
 // Remove sets the deleted flag for a project (soft delete).
-func (r *projectRepo) Remove(ctx context.Context, p *biz.Project) (err error) {
+//
+// The materialized path of the project is kept untouched, so its descendants still resolve their ancestors.
+// When the project carries an entity tag, it is only deleted if it has not changed since, see [expectedVersion].
+func (r *projectRepo) Remove(ctx context.Context, p *biz.Project, group string) (err error) {
 	var proj *ent.Project
-	if proj, err = r.db.Client.Project.Query().Where(project.ProjectID(p.ProjectID)).First(ctx); err != nil {
+	if proj, err = r.query(ctx).Where(project.ProjectID(p.ProjectId), project.Deleted(false)).First(ctx); err != nil {
+		return err
+	}
+	expected, err := expectedVersion(p.Etag)
+	if err != nil {
 		return err
 	}
 
 	// Set the deleted flag to true (soft delete)
-	return r.db.Client.Project.Update().Where(project.ProjectID(proj.ProjectID)).
-		SetDeleted(true).Exec(ctx)
+	n, err := r.db.DB(ctx).Project.Update().
+		Where(ofTenant(ctx), project.ProjectID(proj.ProjectID), project.Deleted(false)).
+		Where(expected...).
+		SetDeleted(true).
+		SetDeletedAt(time.Now()).
+		SetDeleteGroup(group).
+		AddVersion(1).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errStaleEtag(p)
+	}
+	r.invalidate(ctx, proj.ProjectID)
+	return nil
 }
 
-// Update modifies an existing project in the database.
-func (r *projectRepo) Update(ctx context.Context, p *biz.Project) error {
-	return r.db.Client.Project.Update().
-		Where(project.ProjectID(p.ProjectID)).
-		SetDesc(p.Desc).
-		SetLocation(p.Location).
-		SetCoordinate(p.Coordinate).
+// RemoveSubtree soft deletes the project together with all its live descendants, which join the same delete group.
+// Descendants deleted earlier keep their own group, so they stay in the trash when the group is restored.
+// The entity tag of the project is checked like [projectRepo.Remove] does, not those of the descendants.
+func (r *projectRepo) RemoveSubtree(ctx context.Context, p *biz.Project, group string) (err error) {
+	var proj *ent.Project
+	if proj, err = r.query(ctx).Where(project.ProjectID(p.ProjectId), project.Deleted(false)).First(ctx); err != nil {
+		return err
+	}
+	subtree, err := subtreeOf(proj)
+	if err != nil {
+		return err
+	}
+	if err = r.invalidateSubtree(ctx, proj); err != nil {
+		return err
+	}
+	if err = r.Remove(ctx, p, group); err != nil {
+		return err
+	}
+	return r.db.DB(ctx).Project.Update().
+		Where(ofTenant(ctx), subtree, project.Deleted(false)).
+		SetDeleted(true).
+		SetDeletedAt(time.Now()).
+		SetDeleteGroup(group).
+		AddVersion(1).
 		Exec(ctx)
 }
 
-// FindById retrieves a project by its ID.
+// FindChildIds retrieves the IDs of the live direct children of the project.
+func (r *projectRepo) FindChildIds(ctx context.Context, id string) ([]string, error) {
+	return r.query(ctx).
+		Where(project.ParentProjID(id), project.Deleted(false)).
+		Select(project.FieldProjectID).
+		Strings(ctx)
+}
+
+// Update modifies the given fields of an existing live project in the database, leaving the others untouched.
+//
+// It runs in a transaction so that the cached lookups are only dropped once the new values are committed.
+// When the project carries an entity tag, it is only updated if it has not changed since, see [expectedVersion].
+func (r *projectRepo) Update(ctx context.Context, p *biz.Project, fields []string) error {
+	expected, err := expectedVersion(p.Etag)
+	if err != nil {
+		return err
+	}
+	return r.db.InTx(ctx, func(ctx context.Context) error {
+		proj, err := r.query(ctx).Where(project.ProjectID(p.ProjectId), project.Deleted(false)).First(ctx)
+		if err != nil {
+			return err
+		}
+		// The project shows up in the cached paths of its descendants as well
+		if err = r.invalidateSubtree(ctx, proj); err != nil {
+			return err
+		}
+		update := r.db.DB(ctx).Project.UpdateOne(proj).
+			Where(project.Deleted(false)).
+			Where(expected...).
+			AddVersion(1)
+		for _, field := range fields {
+			switch field {
+			case "desc":
+				update.SetDesc(p.Desc)
+			case "location":
+				update.SetLocation(p.Location)
+			case "coordinate":
+				if p.Coordinate == nil {
+					return errMissingCoordinate(p.ProjectId)
+				}
+				update.SetCoordinate(toSchemaPoint(p.Coordinate))
+			case "boundary":
+				if p.Boundary != nil {
+					update.SetBoundary(toSchemaPolygon(p.Boundary))
+				} else {
+					update.ClearBoundary()
+				}
+			default:
+				return v1.ErrorMalformedInput("The field %v of a project cannot be updated", field)
+			}
+		}
+		// The row is still there, so missing it means that its version no longer matches
+		if err = update.Exec(ctx); ent.IsNotFound(err) {
+			return errStaleEtag(p)
+		}
+		return err
+	})
+}
+
+// Move attaches the project to a new parent and rewrites the materialized paths of its whole subtree.
+//
+// All the rows of the subtree are updated in a single transaction, so readers never observe a half-moved tree.
+// The rows of the project and of its new parent are locked before their paths are read, so that two concurrent
+// moves of each project under the other cannot both succeed, the second one failing with the reason
+// INVALID_PARENT once the first one is committed.
+func (r *projectRepo) Move(ctx context.Context, projectId string, newParentId string) error {
+	return r.db.InTx(ctx, func(ctx context.Context) error {
+		proj, err := r.forUpdate(r.query(ctx).Where(project.ProjectID(projectId))).First(ctx)
+		if err != nil {
+			return err
+		}
+		subtree, err := subtreeOf(proj)
+		if err != nil {
+			return err
+		}
+		newPath, newDepth := projectPathSeparator+projectId+projectPathSeparator, 0
+		if newParentId != "" {
+			parent, err := r.forUpdate(r.query(ctx).Where(project.ProjectID(newParentId))).First(ctx)
+			if err != nil {
+				return err
+			}
+			if parent.Path == "" {
+				return errMissingPath(newParentId)
+			}
+			if strings.HasPrefix(parent.Path, proj.Path) {
+				return v1.ErrorInvalidParent("Cannot move project %v under its own descendant %v", projectId, newParentId)
+			}
+			newPath, newDepth = parent.Path+projectId+projectPathSeparator, parent.Depth+1
+		}
+
+		// The subtree includes the project itself, since its path is a prefix of itself
+		rows, err := r.query(ctx).Where(subtree).All(ctx)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(rows))
+		for _, p := range rows {
+			ids = append(ids, p.ProjectID)
+			update := r.db.DB(ctx).Project.UpdateOne(p).
+				SetPath(newPath + strings.TrimPrefix(p.Path, proj.Path)).
+				SetDepth(p.Depth - proj.Depth + newDepth).
+				AddVersion(1)
+			if p.ID == proj.ID {
+				update.SetParentProjID(newParentId)
+			}
+			if err = update.Exec(ctx); err != nil {
+				return err
+			}
+		}
+		r.invalidate(ctx, ids...)
+		return nil
+	})
+}
+
+// FindSubtree retrieves the project and all of its descendants, live or deleted, in no particular order.
+func (r *projectRepo) FindSubtree(ctx context.Context, id string) ([]*biz.Project, error) {
+	root, err := r.query(ctx).Where(project.ProjectID(id)).First(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := subtreeOf(root)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := r.query(ctx).Where(subtree).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]*biz.Project, 0, len(ps))
+	for _, p := range ps {
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, proj)
+	}
+	return projects, nil
+}
+
+// IsDescendantOf reports whether the project is a strict descendant of the project ancestorId, which a missing
+// project is not.
+func (r *projectRepo) IsDescendantOf(ctx context.Context, projectId string, ancestorId string) (bool, error) {
+	proj, err := r.query(ctx).Where(project.ProjectID(projectId)).Select(project.FieldPath).First(ctx)
+	if ent.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if proj.Path == "" {
+		return false, errMissingPath(projectId)
+	}
+	return projectId != ancestorId && strings.Contains(proj.Path, projectPathSeparator+ancestorId+projectPathSeparator), nil
+}
+
+// FindById retrieves a live project by its ID.
+//
+// Lookups outside transactions are served by the cache, while transactions always read their own view of the db.
 func (r *projectRepo) FindById(ctx context.Context, id string) (proj *biz.Project, err error) {
+	if r.db.inTx(ctx) {
+		return r.findById(ctx, id)
+	}
+	raw, err := r.cache.readThrough(ctx, projectKey(biz.TenantFromContext(ctx), id), r.cache.ProjectTTL, func(ctx context.Context) ([]byte, error) {
+		proj, err := r.findById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return protojson.Marshal(proj)
+	})
+	if err != nil {
+		return nil, err
+	}
+	proj = &biz.Project{}
+	return proj, protojson.Unmarshal(raw, proj)
+}
+
+// findById retrieves a live project by its ID from the db.
+func (r *projectRepo) findById(ctx context.Context, id string) (proj *biz.Project, err error) {
 	var p *ent.Project
-	if p, err = r.db.Client.Project.Query().Where(project.ProjectID(id)).First(ctx); err != nil {
+	if p, err = r.query(ctx).Where(project.ProjectID(id), project.Deleted(false)).First(ctx); err != nil {
 		return nil, err
 	}
 	return convertToBizProject(p)
 }
 
-// FindByName retrieves a project by its name.
+// FindDeletedById retrieves a soft deleted project by its ID.
+func (r *projectRepo) FindDeletedById(ctx context.Context, id string) (proj *biz.Project, err error) {
+	var p *ent.Project
+	if p, err = r.query(ctx).Where(project.ProjectID(id), project.Deleted(true)).First(ctx); err != nil {
+		return nil, err
+	}
+	return convertToBizProject(p)
+}
+
+// FindByName retrieves a live project by its name.
 func (r *projectRepo) FindByName(ctx context.Context, name string) (proj *biz.Project, err error) {
 	var p *ent.Project
-	if p, err = r.db.Client.Project.Query().Where(project.ProjectID(name)).First(ctx); err != nil {
+	if p, err = r.query(ctx).Where(project.ProjectID(name), project.Deleted(false)).First(ctx); err != nil {
 		return nil, err
 	}
 	return convertToBizProject(p)
 }
 
-// RecoverById recovers a soft-deleted project by its ID.
+// RecoverById recovers a soft-deleted project by its ID, together with the descendants deleted in the same group.
 func (r *projectRepo) RecoverById(ctx context.Context, id string) (err error) {
 	var proj *ent.Project
-	if proj, err = r.db.Client.Project.Query().Where(project.ProjectID(id)).First(ctx); err != nil {
+	if proj, err = r.query(ctx).Where(project.ProjectID(id), project.Deleted(true)).First(ctx); err != nil {
+		return err
+	}
+	// Projects deleted before delete groups were introduced are restored alone
+	restored := project.ProjectID(proj.ProjectID)
+	if proj.DeleteGroup != "" {
+		subtree, err := subtreeOf(proj)
+		if err != nil {
+			return err
+		}
+		restored = project.And(subtree, project.DeleteGroup(proj.DeleteGroup))
+	}
+	// The restored projects may have been cached as absent
+	if err = r.invalidateSubtree(ctx, proj); err != nil {
+		return err
+	}
+	return r.db.DB(ctx).Project.Update().
+		Where(ofTenant(ctx), restored, project.Deleted(true)).
+		SetDeleted(false).
+		ClearDeletedAt().
+		ClearDeleteGroup().
+		AddVersion(1).
+		Exec(ctx)
+}
+
+// HasLiveDescendants reports whether any strict descendant of the project has not been soft deleted, which a
+// missing project has not.
+func (r *projectRepo) HasLiveDescendants(ctx context.Context, id string) (bool, error) {
+	proj, err := r.query(ctx).Where(project.ProjectID(id)).Select(project.FieldProjectID, project.FieldPath).First(ctx)
+	if ent.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	subtree, err := subtreeOf(proj)
+	if err != nil {
+		return false, err
+	}
+	return r.query(ctx).
+		Where(subtree, project.ProjectIDNEQ(id), project.Deleted(false)).
+		Exist(ctx)
+}
+
+// HasDescendantsDeletedSince reports whether any strict descendant of the project was soft deleted at or after the
+// time, which a missing project has not.
+func (r *projectRepo) HasDescendantsDeletedSince(ctx context.Context, id string, since time.Time) (bool, error) {
+	proj, err := r.query(ctx).Where(project.ProjectID(id)).Select(project.FieldProjectID, project.FieldPath).First(ctx)
+	if ent.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	subtree, err := subtreeOf(proj)
+	if err != nil {
+		return false, err
+	}
+	return r.query(ctx).
+		Where(subtree, project.ProjectIDNEQ(id), project.Deleted(true), project.DeletedAtGTE(since)).
+		Exist(ctx)
+}
+
+// Purge permanently deletes the soft deleted project together with its soft deleted descendants, only the ones
+// deleted before deletedBefore unless it is zero.
+//
+// The roles granted on the purged projects and their revisions are deleted as well, so that they do not apply to
+// projects created later with the same IDs. The audit log keeps the events of the purged projects.
+func (r *projectRepo) Purge(ctx context.Context, id string, deletedBefore time.Time) error {
+	return r.db.InTx(ctx, func(ctx context.Context) error {
+		proj, err := r.query(ctx).Where(project.ProjectID(id), project.Deleted(true)).First(ctx)
+		if err != nil {
+			return err
+		}
+		subtree, err := subtreeOf(proj)
+		if err != nil {
+			return err
+		}
+		purged := project.And(subtree, project.Deleted(true))
+		if !deletedBefore.IsZero() {
+			purged = project.And(purged, project.DeletedAtLT(deletedBefore))
+		}
+		ids, err := r.query(ctx).Where(purged).Select(project.FieldProjectID).Strings(ctx)
+		if err != nil {
+			return err
+		}
+		tenant := biz.TenantFromContext(ctx)
+		if _, err = r.db.DB(ctx).Membership.Delete().
+			Where(membership.TenantID(tenant), membership.ProjectIDIn(ids...)).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err = r.db.DB(ctx).ProjectRevision.Delete().
+			Where(projectrevision.TenantID(tenant), projectrevision.ProjectIDIn(ids...)).Exec(ctx); err != nil {
+			return err
+		}
+		_, err = r.db.DB(ctx).Project.Delete().Where(ofTenant(ctx), purged).Exec(ctx)
 		return err
+	})
+}
+
+// FindTenantsInTrash retrieves the tenants that have soft deleted projects. Unlike the other methods, it looks
+// across all the tenants.
+func (r *projectRepo) FindTenantsInTrash(ctx context.Context) ([]string, error) {
+	return r.db.DB(ctx).Project.Query().
+		Where(project.Deleted(true)).
+		Unique(true).
+		Select(project.FieldTenantID).
+		Strings(ctx)
+}
+
+// FindExpiredIds retrieves the IDs of at most limit projects soft deleted before the cutoff, deepest first,
+// so that descendants are purged before their ancestors.
+func (r *projectRepo) FindExpiredIds(ctx context.Context, cutoff time.Time, limit int) ([]string, error) {
+	return r.query(ctx).
+		Where(project.Deleted(true), project.DeletedAtLT(cutoff)).
+		Order(ent.Desc(project.FieldDepth), ent.Asc(project.FieldDeletedAt)).
+		Limit(limit).
+		Select(project.FieldProjectID).
+		Strings(ctx)
+}
+
+// GetAncestorIds returns the IDs on the materialized path of the project, whether it is soft deleted or not.
+func (r *projectRepo) GetAncestorIds(ctx context.Context, id string) ([]string, error) {
+	proj, err := r.query(ctx).Where(project.ProjectID(id)).Select(project.FieldProjectID, project.FieldPath).First(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if proj.Path == "" {
+		return nil, errMissingPath(id)
 	}
-	return r.db.Client.Project.Update().Where(project.ProjectID(proj.ProjectID)).
-		SetDeleted(false).Exec(ctx)
+	return splitProjectPath(proj.Path), nil
+}
+
+// GetAncestorIdsByIds returns the IDs on the materialized paths of the projects, whether they are soft deleted or
+// not, by the IDs of the projects. Missing projects are left out.
+func (r *projectRepo) GetAncestorIdsByIds(ctx context.Context, ids []string) (map[string][]string, error) {
+	projects, err := r.query(ctx).
+		Where(project.ProjectIDIn(ids...)).
+		Select(project.FieldProjectID, project.FieldPath).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string][]string, len(projects))
+	for _, p := range projects {
+		paths[p.ProjectID] = splitProjectPath(p.Path)
+	}
+	return paths, nil
 }
 
 // IsProjectIDExist checks if a project ID exists in the database.
 func (r *projectRepo) IsProjectIDExist(ctx context.Context, projectID string) (bool, error) {
 	// Check if project ID exists using Bloom filter
-	if r.cache.Client.BFExists(ctx, "project:names", projectID).Val() { // If already in cache, check DB
-		exists, err := r.db.Client.Project.Query().Where(project.ProjectID(projectID)).Exist(ctx)
-		return exists, err
+	maybe, known := r.cache.names.mayContain(ctx, tenantScoped(biz.TenantFromContext(ctx), projectID))
+	if !maybe {
+		bloomLookups.WithLabelValues("negative").Inc()
+		return false, nil
+	}
+	// A positive answer may be a false positive, so the DB has the final say
+	exists, err := r.query(ctx).Where(project.ProjectID(projectID)).Exist(ctx)
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+	switch {
+	case !known:
+		bloomLookups.WithLabelValues("bypassed").Inc()
+	case exists:
+		bloomLookups.WithLabelValues("positive").Inc()
+	default:
+		bloomLookups.WithLabelValues("positive").Inc()
+		bloomFalsePositives.Inc()
+	}
+	return exists, nil
+}
+
+// RebuildProjectFilter rebuilds the Bloom filter of the project IDs from the database and returns how many IDs
+// it holds.
+func (r *projectRepo) RebuildProjectFilter(ctx context.Context) (int, error) {
+	return r.cache.names.rebuild(ctx, r.db.Client)
 }
+
+// GetProjectPath retrieves the ancestors of the project from the root down to the project itself.
+//
+// The IDs of the ancestors are read from the materialized path, so the whole chain is loaded by one query
+// no matter how deep the project is.
+//
+// Like [projectRepo.FindById], the lookups outside transactions are served by the cache.
 func (r *projectRepo) GetProjectPath(ctx context.Context, projectId string) ([]*biz.Project, error) {
-	var projectPath []*biz.Project
-	currentProject, err := r.db.Client.Project.Query().Where(project.IDEQ(projectId)).First(ctx)
+	if r.db.inTx(ctx) {
+		return r.getProjectPath(ctx, projectId)
+	}
+	raw, err := r.cache.readThrough(ctx, projectPathKey(biz.TenantFromContext(ctx), projectId), r.cache.PathTTL, func(ctx context.Context) ([]byte, error) {
+		path, err := r.getProjectPath(ctx, projectId)
+		if err != nil {
+			return nil, err
+		}
+		return marshalProjects(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProjects(raw)
+}
+
+// getProjectPath retrieves the ancestors of the project from the db.
+func (r *projectRepo) getProjectPath(ctx context.Context, projectId string) ([]*biz.Project, error) {
+	current, err := r.query(ctx).Where(project.ProjectID(projectId), project.Deleted(false)).First(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if current.Path == "" {
+		return nil, errMissingPath(projectId)
+	}
 
-	// Add the current project to the path
-	projectPath = append(projectPath, currentProject)
+	ancestors, err := r.query(ctx).
+		Where(project.ProjectIDIn(splitProjectPath(current.Path)...)).
+		Order(ent.Asc(project.FieldDepth)).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	// Recursively add parent projects to the path
-	for currentProject.ParentProjID != "" {
-		parentProject, err := r.db.Client.Project.Query().Where(project.IDEQ(currentProject.ParentProjID)).First(ctx)
+	projectList := make([]*biz.Project, 0, len(ancestors))
+	for _, p := range ancestors {
+		proj, err := convertToBizProject(p)
 		if err != nil {
 			return nil, err
 		}
-		projectPath = append(projectPath, parentProject)
-		currentProject = parentProject
+		projectList = append(projectList, proj)
 	}
+	return projectList, nil
+}
 
-	// Reverse the project path to return from root to current project
-	for i := 0; i < len(projectPath)/2; i++ {
-		projectPath[i], projectPath[len(projectPath)-1-i] = projectPath[len(projectPath)-1-i], projectPath[i]
+// GetProjectSubtree retrieves the project and all of its descendants in breadth-first order.
+//
+// Descendants are matched by the prefix of their materialized paths, so the subtree is loaded by one query
+// no matter how deep it is. A non-positive maxDepth means the whole subtree is returned.
+func (r *projectRepo) GetProjectSubtree(ctx context.Context, projectId string, maxDepth int) ([]*biz.Project, error) {
+	root, err := r.query(ctx).Where(project.ProjectID(projectId), project.Deleted(false)).First(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	var projectList []*v1.Project
-	for _, p := range projectPath {
+	subtree, err := subtreeOf(root)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(subtree, project.Deleted(false))
+	if maxDepth > 0 {
+		query.Where(project.DepthLTE(root.Depth + maxDepth))
+	}
+	descendants, err := query.
+		Order(ent.Asc(project.FieldDepth), ent.Asc(project.FieldProjectID)).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]*biz.Project, 0, len(descendants))
+	for _, p := range descendants {
 		proj, err := convertToBizProject(p)
 		if err != nil {
 			return nil, err
 		}
-		projectList = append(projectList, proj)
+		projects = append(projects, proj)
 	}
-
-	return projectList, nil
+	return projects, nil
 }
+
 func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-	const EarthRadius = 6371 // Earth radius in kilometers
+	const EarthRadius = earthRadius / 1000 // Earth radius in kilometers
 
 	// Convert degrees to radians
 	lat1 = lat1 * math.Pi / 180
@@ -175,10 +873,51 @@ func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 
 	return EarthRadius * c // Returns distance in kilometers
 }
-func (r *projectRepo) FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*biz.Project, error) {
-	var nearbyProjects []*v1.Project
-	// Retrieve all projects
-	projects, err := r.db.Client.Project.Query().All(ctx)
+
+// FindNearbyProjects retrieves the projects within the radius in kilometers of the location, nearest first.
+//
+// Databases with spatial support filter and sort the projects themselves with the help of the spatial index on
+// the coordinates. For the others every project is loaded and filtered with the haversine formula in the process.
+func (r *projectRepo) FindNearbyProjects(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*v1.NearbyProject, error) {
+	if !r.supportsSpatial() {
+		return r.findNearbyProjectsInProcess(ctx, location, radius)
+	}
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := r.query(ctx).
+		Where(project.Deleted(false), coordinateNear(location, radius)).
+		Where(visible...).
+		Order(byDistance(location)).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nearbyProjects := make([]*v1.NearbyProject, 0, len(projects))
+	for _, p := range projects {
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		nearbyProjects = append(nearbyProjects, &v1.NearbyProject{
+			Project:  proj,
+			Distance: haversine(location.Latitude, location.Longitude, p.Coordinate.Lat, p.Coordinate.Lng),
+		})
+	}
+	return nearbyProjects, nil
+}
+
+// findNearbyProjectsInProcess is the fallback of [projectRepo.FindNearbyProjects] for databases without spatial support.
+func (r *projectRepo) findNearbyProjectsInProcess(ctx context.Context, location *v1.GeoPoint, radius float64) ([]*v1.NearbyProject, error) {
+	var nearbyProjects []*v1.NearbyProject
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Retrieve all live projects
+	projects, err := r.query(ctx).Where(project.Deleted(false)).Where(visible...).All(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +930,7 @@ func (r *projectRepo) FindNearbyProjects(ctx context.Context, location *v1.GeoPo
 		}
 
 		// Calculate the distance between the current project and the target location
-		distance := haversine(location.Latitude, location.Longitude, p.Coordinate.Latitude, p.Coordinate.Longitude)
+		distance := haversine(location.Latitude, location.Longitude, p.Coordinate.Lat, p.Coordinate.Lng)
 
 		// If the distance is within the radius, add the project to the result
 		if distance <= radius {
@@ -199,9 +938,265 @@ func (r *projectRepo) FindNearbyProjects(ctx context.Context, location *v1.GeoPo
 			if err != nil {
 				return nil, err
 			}
-			nearbyProjects = append(nearbyProjects, proj)
+			nearbyProjects = append(nearbyProjects, &v1.NearbyProject{Project: proj, Distance: distance})
 		}
 	}
 
+	sort.SliceStable(nearbyProjects, func(i, j int) bool {
+		return nearbyProjects[i].Distance < nearbyProjects[j].Distance
+	})
 	return nearbyProjects, nil
 }
+
+// FindNearestProjects retrieves the k live projects nearest to the location, optionally within the subtree of rootId.
+func (r *projectRepo) FindNearestProjects(ctx context.Context, location *v1.GeoPoint, k int, rootId string) ([]*v1.NearbyProject, error) {
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := r.liveInSubtree(ctx, rootId)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(subtree...).Where(visible...)
+	var projects []*ent.Project
+	if r.supportsSpatial() {
+		projects, err = query.Order(byDistance(location)).Limit(k).All(ctx)
+	} else {
+		projects, err = query.All(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nearestProjects := make([]*v1.NearbyProject, 0, len(projects))
+	for _, p := range projects {
+		if p.Coordinate == nil {
+			continue
+		}
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		nearestProjects = append(nearestProjects, &v1.NearbyProject{
+			Project:  proj,
+			Distance: haversine(location.Latitude, location.Longitude, p.Coordinate.Lat, p.Coordinate.Lng),
+		})
+	}
+
+	// Projects sorted by the database stay in the same order, the others are sorted and truncated here
+	sort.SliceStable(nearestProjects, func(i, j int) bool {
+		return nearestProjects[i].Distance < nearestProjects[j].Distance
+	})
+	if len(nearestProjects) > k {
+		nearestProjects = nearestProjects[:k]
+	}
+	return nearestProjects, nil
+}
+
+// FindProjectsInBounds retrieves the live projects located inside the rectangle between the south-west and
+// the north-east corners, optionally within the subtree of rootId.
+func (r *projectRepo) FindProjectsInBounds(ctx context.Context, southWest, northEast *v1.GeoPoint, rootId string) ([]*biz.Project, error) {
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := r.liveInSubtree(ctx, rootId)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(subtree...).Where(visible...)
+	if r.supportsSpatial() {
+		query.Where(coordinateInBounds(southWest, northEast))
+	}
+	projects, err := query.Order(ent.Asc(project.FieldProjectID)).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	boundedProjects := make([]*biz.Project, 0, len(projects))
+	for _, p := range projects {
+		if p.Coordinate == nil || !inBounds(p.Coordinate, southWest, northEast) {
+			continue
+		}
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		boundedProjects = append(boundedProjects, proj)
+	}
+	return boundedProjects, nil
+}
+
+// FindProjectsInPolygon retrieves the live projects whose coordinates lie inside the polygon,
+// optionally within the subtree of rootId.
+func (r *projectRepo) FindProjectsInPolygon(ctx context.Context, polygon *v1.GeoPolygon, rootId string) ([]*biz.Project, error) {
+	fence := toSchemaPolygon(polygon)
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := r.liveInSubtree(ctx, rootId)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(subtree...).Where(visible...)
+	if r.supportsSpatial() {
+		query.Where(coordinateInPolygon(fence))
+	}
+	projects, err := query.Order(ent.Asc(project.FieldProjectID)).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fencedProjects := make([]*biz.Project, 0, len(projects))
+	for _, p := range projects {
+		if !r.supportsSpatial() && (p.Coordinate == nil || !fence.Contains(*p.Coordinate)) {
+			continue
+		}
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		fencedProjects = append(fencedProjects, proj)
+	}
+	return fencedProjects, nil
+}
+
+// FindProjectsContainingPoint retrieves the live projects whose boundaries contain the location,
+// optionally within the subtree of rootId.
+func (r *projectRepo) FindProjectsContainingPoint(ctx context.Context, location *v1.GeoPoint, rootId string) ([]*biz.Project, error) {
+	point := toSchemaPoint(location)
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subtree, err := r.liveInSubtree(ctx, rootId)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(subtree...).Where(visible...).Where(project.BoundaryNotNil())
+	if r.supportsSpatial() {
+		query.Where(boundaryContains(point))
+	}
+	projects, err := query.Order(ent.Asc(project.FieldProjectID)).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	containingProjects := make([]*biz.Project, 0, len(projects))
+	for _, p := range projects {
+		if !r.supportsSpatial() && (p.Boundary == nil || !p.Boundary.Contains(*point)) {
+			continue
+		}
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		containingProjects = append(containingProjects, proj)
+	}
+	return containingProjects, nil
+}
+
+// ListProjects retrieves at most limit projects matching the filter, starting right after the cursor when given.
+func (r *projectRepo) ListProjects(ctx context.Context, filter *biz.ListProjectsFilter, after *biz.ProjectCursor, limit int) ([]*biz.Project, error) {
+	visible, err := r.visibleToCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := r.query(ctx).Where(visible...)
+	if filter.SubtreeRootId != "" {
+		root, err := r.query(ctx).Where(project.ProjectID(filter.SubtreeRootId)).
+			Select(project.FieldProjectID, project.FieldPath, project.FieldDepth).
+			First(ctx)
+		if err != nil {
+			return nil, err
+		}
+		subtree, err := subtreeOf(root)
+		if err != nil {
+			return nil, err
+		}
+		query.Where(subtree)
+		if filter.MaxDepth > 0 {
+			query.Where(project.DepthLTE(root.Depth + int(filter.MaxDepth)))
+		}
+	}
+	if filter.ParentProjId != "" {
+		query.Where(project.ParentProjID(filter.ParentProjId))
+	}
+	if filter.LocationContains != "" {
+		query.Where(project.LocationContains(filter.LocationContains))
+	}
+	if !filter.CreateAfter.IsZero() {
+		query.Where(project.CreateTimeGTE(filter.CreateAfter))
+	}
+	if !filter.CreateBefore.IsZero() {
+		query.Where(project.CreateTimeLT(filter.CreateBefore))
+	}
+	if !filter.UpdateAfter.IsZero() {
+		query.Where(project.LastUpdateGTE(filter.UpdateAfter))
+	}
+	if !filter.UpdateBefore.IsZero() {
+		query.Where(project.LastUpdateLT(filter.UpdateBefore))
+	}
+	switch filter.Deleted {
+	case v1.DeletedFilter_DELETED_FILTER_EXCLUDE:
+		query.Where(project.Deleted(false))
+	case v1.DeletedFilter_DELETED_FILTER_ONLY:
+		query.Where(project.Deleted(true))
+	}
+
+	// Projects are ordered by the sort key first and then by the project ID, which makes the order total
+	column := project.FieldProjectID
+	switch filter.OrderBy {
+	case v1.ListOrder_LIST_ORDER_CREATE_TIME:
+		column = project.FieldCreateTime
+	case v1.ListOrder_LIST_ORDER_LAST_UPDATE:
+		column = project.FieldLastUpdate
+	}
+	direction := ent.Asc
+	if filter.Descending {
+		direction = ent.Desc
+	}
+	if after != nil {
+		query.Where(afterCursor(column, after, filter.Descending))
+	}
+	if column != project.FieldProjectID {
+		query.Order(direction(column))
+	}
+	projects, err := query.Order(direction(project.FieldProjectID)).Limit(limit).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bizProjects := make([]*biz.Project, 0, len(projects))
+	for _, p := range projects {
+		proj, err := convertToBizProject(p)
+		if err != nil {
+			return nil, err
+		}
+		bizProjects = append(bizProjects, proj)
+	}
+	return bizProjects, nil
+}
+
+// afterCursor matches the projects that follow the cursor when ordered by the column and then by the project ID.
+func afterCursor(column string, after *biz.ProjectCursor, descending bool) predicate.Project {
+	beyond := sql.GT
+	if descending {
+		beyond = sql.LT
+	}
+	return func(s *sql.Selector) {
+		if column == project.FieldProjectID {
+			s.Where(beyond(s.C(project.FieldProjectID), after.ProjectId))
+			return
+		}
+		s.Where(sql.Or(
+			beyond(s.C(column), after.Time),
+			sql.And(
+				sql.EQ(s.C(column), after.Time),
+				beyond(s.C(project.FieldProjectID), after.ProjectId),
+			),
+		))
+	}
+}
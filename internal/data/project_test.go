@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+func TestProjectWithoutCoordinateIsRefused(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	ctx := biz.NewTenantContext(context.Background(), "a")
+
+	if err := mgr.Add(ctx, &biz.Project{ProjectId: "site"}); !v1.IsMalformedInput(err) {
+		t.Errorf("creating a project without a coordinate: got %v, want MALFORMED_INPUT", err)
+	}
+	addProject(t, mgr, "a", "site", "")
+	if _, err := mgr.Update(ctx, &biz.Project{ProjectId: "site"}, []string{"coordinate"}); !v1.IsMalformedInput(err) {
+		t.Errorf("clearing the coordinate of a project: got %v, want MALFORMED_INPUT", err)
+	}
+
+	// Written past the checks, a missing coordinate is refused by the db rather than crashing the service
+	err := repo.(*projectRepo).db.Client.Project.Create().
+		SetProjectID("bare").
+		SetCoordinate(nil).
+		Exec(ctx)
+	if err == nil {
+		t.Error("the db stored a project without a coordinate")
+	}
+}
+
+func TestProjectInTheTrashCannotBeUpdated(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	addProject(t, mgr, "a", "site", "")
+	ctx := biz.NewTenantContext(context.Background(), "a")
+	if err := mgr.RemoveById(ctx, "site", v1.DeletionPolicy_DELETION_POLICY_REJECT, ""); err != nil {
+		t.Fatalf("deleting the project: %v", err)
+	}
+
+	update := &biz.Project{ProjectId: "site", Desc: "changed"}
+	if _, err := mgr.Update(ctx, update, []string{"desc"}); !v1.IsProjectNotFound(err) {
+		t.Errorf("updating a project in the trash: got %v, want PROJECT_NOT_FOUND", err)
+	}
+	if err := repo.Update(ctx, update, []string{"desc"}); err == nil {
+		t.Error("the repository updated a project in the trash")
+	}
+	if deleted, err := repo.FindDeletedById(ctx, "site"); err != nil || deleted.Desc != "" {
+		t.Errorf("the project in the trash should be left untouched: got %v, %v", deleted, err)
+	}
+}
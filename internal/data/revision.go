@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/ent"
+	"project/internal/ent/projectrevision"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// revisionRepo implements the interface [biz.RevisionRepository] described in the package [project/internal/biz].
+type revisionRepo struct {
+	db *Data
+}
+
+// NewRevisionRepository creates a new revision repository implementation instance and returns the interface value.
+func NewRevisionRepository(database *Data) biz.RevisionRepository {
+	return &revisionRepo{db: database}
+}
+
+// revisionOperations are the values of the enum of the entity for the enum of the messages
+var revisionOperations = map[v1.AuditOperation]projectrevision.Operation{
+	v1.AuditOperation_AUDIT_OPERATION_CREATE:  projectrevision.OperationCreate,
+	v1.AuditOperation_AUDIT_OPERATION_UPDATE:  projectrevision.OperationUpdate,
+	v1.AuditOperation_AUDIT_OPERATION_DELETE:  projectrevision.OperationDelete,
+	v1.AuditOperation_AUDIT_OPERATION_RESTORE: projectrevision.OperationRestore,
+	v1.AuditOperation_AUDIT_OPERATION_MOVE:    projectrevision.OperationMove,
+	v1.AuditOperation_AUDIT_OPERATION_REVERT:  projectrevision.OperationRevert,
+}
+
+// Helper function to convert from ent.ProjectRevision to biz.ProjectRevision
+func convertToBizRevision(r *ent.ProjectRevision) (rev *biz.ProjectRevision, err error) {
+	rev = &biz.ProjectRevision{
+		ProjectId:  r.ProjectID,
+		Revision:   r.Revision,
+		Project:    &biz.Project{},
+		Actor:      r.Actor,
+		CreateTime: timestamppb.New(r.CreateTime),
+	}
+	for op, value := range revisionOperations {
+		if value == r.Operation {
+			rev.Operation = op
+		}
+	}
+	if err = protojson.Unmarshal([]byte(r.Snapshot), rev.Project); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// query starts a query on the revisions of the project of the tenant of the request.
+func (r *revisionRepo) query(ctx context.Context, projectId string) *ent.ProjectRevisionQuery {
+	return r.db.DB(ctx).ProjectRevision.Query().
+		Where(projectrevision.TenantID(biz.TenantFromContext(ctx)), projectrevision.ProjectID(projectId))
+}
+
+// Add stores the revision under the number following the latest revision of the project.
+//
+// The latest revision is read with a locking read, which sees the revisions committed meanwhile rather than the
+// snapshot taken by the earlier reads of the transaction, and keeps another transaction from reading it until this
+// one ends. The revisions of a project are thus numbered one at a time, however the changes interleave.
+func (r *revisionRepo) Add(ctx context.Context, rev *biz.ProjectRevision) (int64, error) {
+	number := int64(1)
+	query := r.query(ctx, rev.ProjectId).Order(ent.Desc(projectrevision.FieldRevision))
+	// SQLite has no row locks, since its transactions write one at a time anyway
+	if r.db.Driver != dialect.SQLite {
+		query.ForUpdate()
+	}
+	latest, err := query.First(ctx)
+	switch {
+	case err == nil:
+		number = latest.Revision + 1
+	case !ent.IsNotFound(err):
+		return 0, err
+	}
+	snapshot, err := protojson.Marshal(rev.Project)
+	if err != nil {
+		return 0, err
+	}
+	return number, r.db.DB(ctx).ProjectRevision.Create().
+		SetTenantID(biz.TenantFromContext(ctx)).
+		SetProjectID(rev.ProjectId).
+		SetRevision(number).
+		SetSnapshot(string(snapshot)).
+		SetOperation(revisionOperations[rev.Operation]).
+		SetActor(rev.Actor).
+		Exec(ctx)
+}
+
+// Get retrieves the revision of the project by its number.
+func (r *revisionRepo) Get(ctx context.Context, projectId string, revision int64) (*biz.ProjectRevision, error) {
+	rev, err := r.query(ctx, projectId).Where(projectrevision.Revision(revision)).Only(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertToBizRevision(rev)
+}
+
+// FindAsOf retrieves the latest revision of the project made at or before the time.
+func (r *revisionRepo) FindAsOf(ctx context.Context, projectId string, at time.Time) (*biz.ProjectRevision, error) {
+	rev, err := r.query(ctx, projectId).
+		Where(projectrevision.CreateTimeLTE(at)).
+		Order(ent.Desc(projectrevision.FieldRevision)).
+		First(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertToBizRevision(rev)
+}
+
+// List retrieves at most limit revisions of the project, latest first, starting below the revision before.
+func (r *revisionRepo) List(ctx context.Context, projectId string, before int64, limit int) ([]*biz.ProjectRevision, error) {
+	query := r.query(ctx, projectId)
+	if before > 0 {
+		query.Where(projectrevision.RevisionLT(before))
+	}
+	revisions, err := query.Order(ent.Desc(projectrevision.FieldRevision)).Limit(limit).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bizRevisions := make([]*biz.ProjectRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		bizRev, err := convertToBizRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		bizRevisions = append(bizRevisions, bizRev)
+	}
+	return bizRevisions, nil
+}
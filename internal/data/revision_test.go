@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/ent/projectrevision"
+)
+
+// between returns a time strictly after the changes made so far and before the next ones.
+func between() time.Time {
+	time.Sleep(10 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	return at
+}
+
+func TestSubtreeOperationsReviseTheDescendants(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	addProject(t, mgr, "a", "root", "")
+	addProject(t, mgr, "a", "child", "root")
+	addProject(t, mgr, "a", "grandchild", "child")
+	ctx := biz.NewTenantContext(context.Background(), "a")
+
+	beforeDelete := between()
+	if err := mgr.RemoveById(ctx, "root", v1.DeletionPolicy_DELETION_POLICY_CASCADE, ""); err != nil {
+		t.Fatalf("deleting the subtree: %v", err)
+	}
+	afterDelete := between()
+	for _, id := range []string{"child", "grandchild"} {
+		if _, err := mgr.GetAsOf(ctx, id, beforeDelete); err != nil {
+			t.Errorf("the project %v as of before the delete: got %v, want it live", id, err)
+		}
+		if _, err := mgr.GetAsOf(ctx, id, afterDelete); !v1.IsProjectNotFound(err) {
+			t.Errorf("the project %v as of after the delete: got %v, want PROJECT_NOT_FOUND", id, err)
+		}
+	}
+
+	if err := mgr.RecoverById(ctx, "root"); err != nil {
+		t.Fatalf("restoring the subtree: %v", err)
+	}
+	if err := mgr.Move(ctx, "child", ""); err != nil {
+		t.Fatalf("moving the child: %v", err)
+	}
+	revisions, _, err := mgr.ListRevisions(ctx, "grandchild", 10, "")
+	if err != nil {
+		t.Fatalf("listing the revisions: %v", err)
+	}
+	want := []v1.AuditOperation{
+		v1.AuditOperation_AUDIT_OPERATION_MOVE,
+		v1.AuditOperation_AUDIT_OPERATION_RESTORE,
+		v1.AuditOperation_AUDIT_OPERATION_DELETE,
+		v1.AuditOperation_AUDIT_OPERATION_CREATE,
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("got %d revisions of the grandchild, want %d", len(revisions), len(want))
+	}
+	for i, rev := range revisions {
+		if rev.Operation != want[i] {
+			t.Errorf("revision %d of the grandchild: got %v, want %v", rev.Revision, rev.Operation, want[i])
+		}
+	}
+	if depth := revisions[0].Project.Depth; depth != 1 {
+		t.Errorf("the grandchild after the move: got the depth %d, want 1", depth)
+	}
+}
+
+func TestMigrationSeedsTheRevisionsOfExistingProjects(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	addProject(t, mgr, "a", "live", "")
+	addProject(t, mgr, "a", "deleted", "")
+	ctx := biz.NewTenantContext(context.Background(), "a")
+	if err := mgr.RemoveById(ctx, "deleted", v1.DeletionPolicy_DELETION_POLICY_REJECT, ""); err != nil {
+		t.Fatalf("deleting the project: %v", err)
+	}
+	afterDelete := between()
+
+	// The projects lose their history, as if they were stored before it was introduced
+	client := repo.(*projectRepo).db.Client
+	if _, err := client.ProjectRevision.Delete().Exec(ctx); err != nil {
+		t.Fatalf("dropping the revisions: %v", err)
+	}
+	if err := seedProjectRevisions(ctx, client); err != nil {
+		t.Fatalf("seeding the revisions: %v", err)
+	}
+	if _, err := mgr.GetAsOf(ctx, "live", afterDelete); err != nil {
+		t.Errorf("the live project: got %v, want it found", err)
+	}
+	if _, err := mgr.GetAsOf(ctx, "deleted", afterDelete); !v1.IsProjectNotFound(err) {
+		t.Errorf("the deleted project after its deletion: got %v, want PROJECT_NOT_FOUND", err)
+	}
+
+	// Seeding again leaves the histories alone
+	if err := seedProjectRevisions(ctx, client); err != nil {
+		t.Fatalf("seeding the revisions again: %v", err)
+	}
+	if count, err := client.ProjectRevision.Query().Where(projectrevision.ProjectID("deleted")).Count(ctx); err != nil || count != 2 {
+		t.Errorf("the revisions of the deleted project: got %d, %v, want 2", count, err)
+	}
+}
+
+func TestRevertRestoresAnEarlierRevision(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	addProject(t, mgr, "a", "first", "")
+	addProject(t, mgr, "a", "second", "")
+	addProject(t, mgr, "a", "child", "first")
+	addProject(t, mgr, "a", "grandchild", "child")
+	ctx := biz.NewTenantContext(context.Background(), "a")
+
+	update := &biz.Project{ProjectId: "child", Desc: "changed", Coordinate: &v1.GeoPoint{Latitude: 3, Longitude: 4}}
+	if _, err := mgr.Update(ctx, update, nil); err != nil {
+		t.Fatalf("updating the child: %v", err)
+	}
+	if err := mgr.Move(ctx, "child", "second"); err != nil {
+		t.Fatalf("moving the child: %v", err)
+	}
+
+	after, number, err := mgr.Revert(ctx, "child", 1)
+	if err != nil {
+		t.Fatalf("reverting the child: %v", err)
+	}
+	if after.Desc != "" || after.ParentProjId != "first" || after.GetCoordinate().GetLatitude() != 1 {
+		t.Errorf("the reverted child: got %v, want the state of its first revision", after)
+	}
+	if number != 4 {
+		t.Errorf("got the revision %d of the revert, want 4", number)
+	}
+	events, _, err := mgr.ListAuditEvents(ctx, &biz.AuditFilter{ProjectId: "child"}, 1, "")
+	if err != nil || len(events) != 1 || events[0].Operation != v1.AuditOperation_AUDIT_OPERATION_REVERT {
+		t.Errorf("the latest event of the child: got %v, %v, want the revert", events, err)
+	}
+	revisions, _, err := mgr.ListRevisions(ctx, "grandchild", 1, "")
+	if err != nil || len(revisions) != 1 || revisions[0].Operation != v1.AuditOperation_AUDIT_OPERATION_MOVE {
+		t.Errorf("the latest revision of the grandchild: got %v, %v, want the move back", revisions, err)
+	}
+}
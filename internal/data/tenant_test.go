@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/conf"
+	"project/internal/ent"
+
+	"github.com/alicebob/miniredis/v2"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestManager creates a project manager backed by an in-memory SQLite db and an in-memory Redis server.
+func newTestManager(t *testing.T) (*biz.ProjectManager, biz.ProjectRepository) {
+	t.Helper()
+	c := &conf.Data{
+		Database: &conf.Data_Database{Driver: "sqlite3", Source: "file:" + t.Name() + "?mode=memory&cache=shared&_fk=1"},
+		Redis:    &conf.Data_Redis{Addr: miniredis.RunT(t).Addr()},
+	}
+	database, cleanupData, err := NewData(c)
+	if err != nil {
+		t.Fatalf("failed to open the db: %v", err)
+	}
+	t.Cleanup(cleanupData)
+	cache, cleanupCache, err := NewCache(c)
+	if err != nil {
+		t.Fatalf("failed to connect to Redis: %v", err)
+	}
+	t.Cleanup(cleanupCache)
+
+	repo := NewProjectRepository(database, cache)
+	mgr := biz.NewProjectManager(repo, NewMembershipRepository(database), NewAuditRepository(database),
+		NewRevisionRepository(database), NewTransaction(database), ulidGenerator{})
+	return mgr, repo
+}
+
+// addProject creates the project in the tenant, failing the test if it cannot.
+func addProject(t *testing.T, mgr *biz.ProjectManager, tenant, id, parentId string) {
+	t.Helper()
+	ctx := biz.NewTenantContext(context.Background(), tenant)
+	p := &biz.Project{ProjectId: id, ParentProjId: parentId, Coordinate: &v1.GeoPoint{Latitude: 1, Longitude: 2}}
+	if err := mgr.Add(ctx, p); err != nil {
+		t.Fatalf("failed to create the project %v of the tenant %q: %v", id, tenant, err)
+	}
+}
+
+func TestProjectsOfAnotherTenantAreHidden(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	addProject(t, mgr, "a", "root", "")
+	addProject(t, mgr, "a", "child", "root")
+	ctx := biz.NewTenantContext(context.Background(), "b")
+
+	if _, err := repo.FindById(ctx, "root"); !ent.IsNotFound(err) {
+		t.Errorf("FindById in another tenant: got %v, want a not found error", err)
+	}
+	if _, err := repo.GetProjectPath(ctx, "child"); !ent.IsNotFound(err) {
+		t.Errorf("GetProjectPath in another tenant: got %v, want a not found error", err)
+	}
+	if _, err := repo.GetProjectSubtree(ctx, "root", 0); !ent.IsNotFound(err) {
+		t.Errorf("GetProjectSubtree in another tenant: got %v, want a not found error", err)
+	}
+	if exists, err := repo.IsProjectIDExist(ctx, "root"); err != nil || exists {
+		t.Errorf("IsProjectIDExist in another tenant: got %v, %v, want false", exists, err)
+	}
+	projects, err := repo.ListProjects(ctx, &biz.ListProjectsFilter{}, nil, 10)
+	if err != nil || len(projects) != 0 {
+		t.Errorf("ListProjects in another tenant: got %d projects, %v, want none", len(projects), err)
+	}
+
+	// The IDs are only unique within a tenant, and the tenants do not share their subtrees
+	addProject(t, mgr, "b", "root", "")
+	subtree, err := repo.GetProjectSubtree(ctx, "root", 0)
+	if err != nil || len(subtree) != 1 {
+		t.Errorf("GetProjectSubtree of the same ID in another tenant: got %d projects, %v, want 1", len(subtree), err)
+	}
+}
+
+func TestMoveAcrossTenantsIsRefused(t *testing.T) {
+	mgr, repo := newTestManager(t)
+	addProject(t, mgr, "a", "site-a", "")
+	addProject(t, mgr, "b", "site-b", "")
+	ctxA := biz.NewTenantContext(context.Background(), "a")
+	ctxB := biz.NewTenantContext(context.Background(), "b")
+
+	if err := mgr.Move(ctxB, "site-b", "site-a"); !v1.IsInvalidParent(err) {
+		t.Errorf("moving under a project of another tenant: got %v, want INVALID_PARENT", err)
+	}
+	if err := mgr.Move(ctxB, "site-a", ""); !v1.IsProjectNotFound(err) {
+		t.Errorf("moving a project of another tenant: got %v, want PROJECT_NOT_FOUND", err)
+	}
+	for _, c := range []struct {
+		ctx context.Context
+		id  string
+	}{{ctxA, "site-a"}, {ctxB, "site-b"}} {
+		path, err := repo.GetProjectPath(c.ctx, c.id)
+		if err != nil || len(path) != 1 {
+			t.Errorf("the project %v should still be a root: got %d ancestors, %v", c.id, len(path), err)
+		}
+	}
+
+	// Within its tenant, the project moves
+	addProject(t, mgr, "b", "other-b", "")
+	if err := mgr.Move(ctxB, "site-b", "other-b"); err != nil {
+		t.Fatalf("moving within the tenant: %v", err)
+	}
+	if path, err := repo.GetProjectPath(ctxB, "site-b"); err != nil || len(path) != 2 {
+		t.Errorf("the project should hang under its new parent: got %d ancestors, %v", len(path), err)
+	}
+}
@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// AuditEvent holds the schema definition for the AuditEvent entity, which records a change made to a Project.
+type AuditEvent struct {
+	ent.Schema
+}
+
+// Fields of the AuditEvent.
+func (AuditEvent) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("tenant_id").
+			MaxLen(64).
+			Default("").
+			Immutable().
+			Comment("Identifier of the tenant of the changed Project, empty for the default tenant"),
+		field.String("actor").
+			Default("").
+			Immutable().
+			Comment("Subject of the caller who made the change, empty for the changes made by the service itself"),
+		field.Enum("operation").
+			Values("create", "update", "delete", "restore", "move", "purge", "revert").
+			Immutable().
+			Comment("Kind of the change"),
+		field.String("project_id").
+			NotEmpty().
+			Immutable().
+			Comment("Identifier of the changed Project"),
+		field.String("project_path").
+			MaxLen(768).
+			Default("").
+			Immutable().
+			Comment("Materialized path of the Project when it changed, which tells the subtrees the change belongs to"),
+		field.Text("before").
+			Optional().
+			Immutable().
+			Comment("JSON snapshot of the Project before the change, absent when it was created"),
+		field.Text("after").
+			Optional().
+			Immutable().
+			Comment("JSON snapshot of the Project after the change, absent when it was purged"),
+		field.String("request_id").
+			Default("").
+			Immutable().
+			Comment("Identifier of the request that made the change"),
+		field.Time("create_time").
+			Default(time.Now).
+			Immutable().
+			Comment("Timestamp of the change"),
+	}
+}
+
+// Edges of the AuditEvent.
+func (AuditEvent) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes of the AuditEvent.
+func (AuditEvent) Indexes() []ent.Index {
+	return []ent.Index{
+		// Index to optimize the history of a Project
+		index.Fields("tenant_id", "project_id"),
+		// Index to optimize the subtree filters, which match the paths by their prefixes. Only the start of the paths
+		// is indexed, like for the paths of the projects, so that the key stays within the limit of InnoDB
+		index.Fields("tenant_id", "project_path").
+			Annotations(entsql.PrefixColumn("project_path", pathIndexPrefix)),
+		// Index to optimize the changes made by a caller
+		index.Fields("tenant_id", "actor"),
+		// Index to optimize the changes made during a time range
+		index.Fields("tenant_id", "create_time"),
+	}
+}
+
+func (AuditEvent) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entsql.WithComments(true),
+		entsql.Annotation{
+			Table:     "project_audit_events",
+			Charset:   "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+			Options:   "ENGINE = InnoDB",
+		},
+		schema.Comment("Audit log of the changes made to the projects"),
+	}
+}
@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+)
+
+// DataMigration holds the schema definition for the DataMigration entity, which records a data migration applied
+// to the database when the application started.
+type DataMigration struct {
+	ent.Schema
+}
+
+// Fields of the DataMigration.
+func (DataMigration) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			NotEmpty().
+			MaxLen(128).
+			Unique().
+			Immutable().
+			Comment("Name of the data migration"),
+		field.Time("create_time").
+			Default(time.Now).
+			Immutable().
+			Comment("Timestamp when the data migration was applied"),
+	}
+}
+
+// Edges of the DataMigration.
+func (DataMigration) Edges() []ent.Edge {
+	return nil
+}
+
+func (DataMigration) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entsql.WithComments(true),
+		entsql.Annotation{
+			Table:     "data_migrations",
+			Charset:   "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+			Options:   "ENGINE = InnoDB",
+		},
+		schema.Comment("Data migrations applied to the database"),
+	}
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// Membership holds the schema definition for the Membership entity, which grants a role on a Project subtree
+// to a user or a group.
+type Membership struct {
+	ent.Schema
+}
+
+// Fields of the Membership.
+func (Membership) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("tenant_id").
+			MaxLen(64).
+			Default("").
+			Immutable().
+			Comment("Identifier of the tenant of the Project the role is granted on, empty for the default tenant"),
+		field.Enum("principal_type").
+			Values("user", "group").
+			Comment("Kind of the principal the role is granted to"),
+		field.String("principal_id").
+			NotEmpty().
+			MaxLen(255).
+			Comment("Subject of the user or name of the group"),
+		field.String("project_id").
+			NotEmpty().
+			Comment("Identifier of the Project at the root of the subtree the role applies to"),
+		field.Enum("role").
+			Values("viewer", "editor", "admin").
+			Comment("Role granted on the Project and all its descendants"),
+		field.String("granted_by").
+			Default("").
+			Comment("Subject of the user who granted the role"),
+		field.Time("create_time").
+			Default(time.Now).
+			Immutable().
+			Comment("Timestamp when the role was granted"),
+	}
+}
+
+// Edges of the Membership.
+func (Membership) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes of the Membership.
+func (Membership) Indexes() []ent.Index {
+	return []ent.Index{
+		// A principal holds at most one role on a Project
+		index.Fields("tenant_id", "principal_type", "principal_id", "project_id").
+			Unique(),
+		// Index to optimize the lookups of the roles granted on the ancestors of a Project
+		index.Fields("tenant_id", "project_id"),
+	}
+}
+
+func (Membership) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entsql.WithComments(true),
+		entsql.Annotation{
+			Table:     "project_memberships",
+			Charset:   "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+			Options:   "ENGINE = InnoDB",
+		},
+		schema.Comment("Roles granted on project subtrees"),
+	}
+}
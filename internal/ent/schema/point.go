@@ -4,10 +4,19 @@ package schema
 //the point.go is used to convey the point in mysql
 import (
 	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"strings"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
 )
 
+// SRID is the spatial reference system of every geometry stored by the service, namely WGS 84.
+const SRID = 4326
+
 // Point represents a geographical point with latitude and longitude.
 type Point struct {
 	Lat float64 // Latitude
@@ -19,13 +28,39 @@ func (p Point) Value() (driver.Value, error) {
 	return fmt.Sprintf("POINT(%f %f)", p.Lng, p.Lat), nil
 }
 
+// FormatParam implements the [entsql.ParamFormatter] interface, so that the WKT text produced by [Point.Value]
+// is converted into a geometry of the spatial reference system [SRID] by databases with spatial support.
+//
+// WKT coordinates are always written as longitude first, so MySQL is told not to apply the latitude-first
+// axis order that it uses by default for geographic reference systems. A nil point is written as NULL, which
+// the database then accepts or refuses depending on the column.
+func (p *Point) FormatParam(placeholder string, info *entsql.StmtInfo) string {
+	if p == nil {
+		return placeholder
+	}
+	return formatGeometryParam(placeholder, info)
+}
+
 // Scan implements the sql.Scanner interface for database deserialization.
+//
+// Besides the WKT text, it accepts the binary geometry returned by MySQL (a 4-byte SRID followed by WKB)
+// and the hex encoded EWKB returned by PostGIS.
 func (p *Point) Scan(value interface{}) error {
-	str, ok := value.(string)
-	if !ok {
-		return fmt.Errorf("failed to convert value to string: %v", value)
+	switch v := value.(type) {
+	case []byte:
+		return p.scanWKB(v, true)
+	case string:
+		if raw, err := hex.DecodeString(v); err == nil {
+			return p.scanWKB(raw, false)
+		}
+		return p.scanWKT(v)
 	}
+	return fmt.Errorf("failed to convert value to string: %v", value)
+}
 
+// scanWKT parses the WKT text of a point.
+func (p *Point) scanWKT(str string) error {
+	value := str
 	// Parse the string to extract latitude and longitude.
 	str = strings.TrimPrefix(str, "POINT(")
 	str = strings.TrimSuffix(str, ")")
@@ -48,3 +83,110 @@ func (p *Point) Scan(value interface{}) error {
 	p.Lng = lng
 	return nil
 }
+
+// scanWKB parses the binary representation of a point.
+func (p *Point) scanWKB(raw []byte, mysql bool) error {
+	r, err := newWKBReader(raw, mysql, wkbPoint)
+	if err != nil {
+		return err
+	}
+	if p.Lng, p.Lat, err = r.coordinate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WKT is a geometry written in well-known text, such as a polygon built for a query. Like [Point], it is
+// converted into a geometry of the spatial reference system [SRID] when used as a query parameter.
+type WKT string
+
+// Value implements the driver.Valuer interface for database serialization.
+func (w WKT) Value() (driver.Value, error) {
+	return string(w), nil
+}
+
+// FormatParam implements the [entsql.ParamFormatter] interface.
+func (WKT) FormatParam(placeholder string, info *entsql.StmtInfo) string {
+	return formatGeometryParam(placeholder, info)
+}
+
+// formatGeometryParam wraps the placeholder of a WKT parameter with the function parsing it into a geometry.
+// Databases without spatial support keep the plain text.
+func formatGeometryParam(placeholder string, info *entsql.StmtInfo) string {
+	switch info.Dialect {
+	case dialect.MySQL:
+		return fmt.Sprintf("ST_GeomFromText(%s, %d, 'axis-order=long-lat')", placeholder, SRID)
+	case dialect.Postgres:
+		return fmt.Sprintf("ST_GeomFromText(%s, %d)", placeholder, SRID)
+	}
+	return placeholder
+}
+
+// WKB geometry types handled by the service
+const (
+	wkbPoint   = 1
+	wkbPolygon = 3
+	// ewkbSRIDFlag is set on the geometry type by PostGIS when an SRID follows the type
+	ewkbSRIDFlag = 0x20000000
+)
+
+// wkbReader reads the well-known binary representation of a geometry.
+type wkbReader struct {
+	raw   []byte
+	order binary.ByteOrder
+}
+
+// newWKBReader checks the header of a geometry and returns a reader positioned right after it.
+//
+// MySQL prefixes the WKB with the 4-byte SRID of the geometry, and PostGIS may embed the SRID behind the type.
+// Both stores keep the coordinates as longitude then latitude.
+func newWKBReader(raw []byte, mysql bool, geometryType uint32) (*wkbReader, error) {
+	if mysql {
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("invalid geometry: %x", raw)
+		}
+		raw = raw[4:]
+	}
+	if len(raw) < 5 {
+		return nil, fmt.Errorf("invalid WKB: %x", raw)
+	}
+	r := &wkbReader{raw: raw[1:], order: binary.LittleEndian}
+	if raw[0] == 0 {
+		r.order = binary.BigEndian
+	}
+	typ, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if typ&ewkbSRIDFlag != 0 {
+		if _, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		typ &^= ewkbSRIDFlag
+	}
+	if typ != geometryType {
+		return nil, fmt.Errorf("unexpected WKB geometry type %d, expecting %d", typ, geometryType)
+	}
+	return r, nil
+}
+
+// uint32 consumes a 32-bit unsigned integer.
+func (r *wkbReader) uint32() (uint32, error) {
+	if len(r.raw) < 4 {
+		return 0, fmt.Errorf("unexpected end of WKB")
+	}
+	v := r.order.Uint32(r.raw)
+	r.raw = r.raw[4:]
+	return v, nil
+}
+
+// coordinate consumes a pair of doubles, namely the longitude and the latitude.
+func (r *wkbReader) coordinate() (lng, lat float64, err error) {
+	if len(r.raw) < 16 {
+		return 0, 0, fmt.Errorf("unexpected end of WKB")
+	}
+	lng = math.Float64frombits(r.order.Uint64(r.raw))
+	lat = math.Float64frombits(r.order.Uint64(r.raw[8:]))
+	r.raw = r.raw[16:]
+	return lng, lat, nil
+}
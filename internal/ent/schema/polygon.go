@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	entsql "entgo.io/ent/dialect/sql"
+)
+
+// Polygon represents a geographical area bounded by a single ring of points, such as the boundary of a site.
+//
+// The ring does not need to repeat its first point at the end, it is closed when the polygon is serialized.
+type Polygon struct {
+	Points []Point // Vertices of the exterior ring
+}
+
+// WKT returns the well-known text of the polygon.
+func (p Polygon) WKT() WKT {
+	if len(p.Points) == 0 {
+		return "POLYGON EMPTY"
+	}
+	ring := p.Points
+	if ring[0] != ring[len(ring)-1] {
+		ring = append(ring[:len(ring):len(ring)], ring[0])
+	}
+	coords := make([]string, 0, len(ring))
+	for _, point := range ring {
+		coords = append(coords, fmt.Sprintf("%f %f", point.Lng, point.Lat))
+	}
+	return WKT("POLYGON((" + strings.Join(coords, ", ") + "))")
+}
+
+// Value implements the driver.Valuer interface for database serialization.
+func (p Polygon) Value() (driver.Value, error) {
+	return string(p.WKT()), nil
+}
+
+// FormatParam implements the [entsql.ParamFormatter] interface in the same way as [Point.FormatParam].
+func (p *Polygon) FormatParam(placeholder string, info *entsql.StmtInfo) string {
+	if p == nil {
+		return placeholder
+	}
+	return formatGeometryParam(placeholder, info)
+}
+
+// Scan implements the sql.Scanner interface for database deserialization.
+//
+// It accepts the same representations as [Point.Scan]. Only the exterior ring is kept, and a NULL value
+// leaves the polygon empty.
+func (p *Polygon) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		p.Points = nil
+		return nil
+	case []byte:
+		return p.scanWKB(v, true)
+	case string:
+		if raw, err := hex.DecodeString(v); err == nil {
+			return p.scanWKB(raw, false)
+		}
+		return p.scanWKT(v)
+	}
+	return fmt.Errorf("failed to convert value to string: %v", value)
+}
+
+// scanWKT parses the WKT text of a polygon.
+func (p *Polygon) scanWKT(str string) error {
+	body := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(str), "POLYGON"))
+	if body == "EMPTY" {
+		p.Points = nil
+		return nil
+	}
+	if !strings.HasPrefix(body, "((") || !strings.HasSuffix(body, "))") {
+		return fmt.Errorf("invalid POLYGON format: %s", str)
+	}
+	// Holes are dropped, only the first ring is the boundary
+	exterior, _, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(body, "(("), "))"), "),")
+	var points []Point
+	for _, coord := range strings.Split(exterior, ",") {
+		var point Point
+		if _, err := fmt.Sscanf(strings.TrimSpace(coord), "%f %f", &point.Lng, &point.Lat); err != nil {
+			return fmt.Errorf("failed to parse polygon vertex %q: %v", coord, err)
+		}
+		points = append(points, point)
+	}
+	p.Points = points
+	return nil
+}
+
+// scanWKB parses the binary representation of a polygon.
+func (p *Polygon) scanWKB(raw []byte, mysql bool) error {
+	r, err := newWKBReader(raw, mysql, wkbPolygon)
+	if err != nil {
+		return err
+	}
+	rings, err := r.uint32()
+	if err != nil {
+		return err
+	}
+	p.Points = nil
+	if rings == 0 {
+		return nil
+	}
+	count, err := r.uint32()
+	if err != nil {
+		return err
+	}
+	points := make([]Point, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var point Point
+		if point.Lng, point.Lat, err = r.coordinate(); err != nil {
+			return err
+		}
+		points = append(points, point)
+	}
+	p.Points = points
+	return nil
+}
+
+// Contains reports whether the point lies inside the polygon, by casting a ray from the point and counting
+// how many edges of the ring it crosses. It serves databases that cannot evaluate spatial predicates.
+func (p Polygon) Contains(point Point) bool {
+	inside := false
+	for i, j := 0, len(p.Points)-1; i < len(p.Points); j, i = i, i+1 {
+		a, b := p.Points[i], p.Points[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) &&
+			point.Lng < (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -1,13 +1,21 @@
-//go:generate ent generate .
+//go:generate ent generate --feature sql/lock,sql/execquery .
 package schema
 
 import (
-	"ariga.io/atlas/sql/schema"
+	"time"
+
 	"entgo.io/ent"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/entsql"
+	"entgo.io/ent/schema"
 	"entgo.io/ent/schema/field"
 	"entgo.io/ent/schema/index"
 )
 
+// pathIndexPrefix is the number of leading characters of the materialized paths held by their index, which keeps
+// the key within the limit of InnoDB along with the tenant
+const pathIndexPrefix = 640
+
 // Project holds the schema definition for the Project entity.
 type Project struct {
 	ent.Schema
@@ -16,13 +24,25 @@ type Project struct {
 // Fields of the Project.
 func (Project) Fields() []ent.Field {
 	return []ent.Field{
+		field.String("tenant_id").
+			MaxLen(64).
+			Default("").
+			Immutable().
+			Comment("Identifier of the tenant owning the Project, empty for the default tenant"),
 		field.String("project_id").
 			NotEmpty().
-			Comment("Unique identifier of the Project"),
+			Comment("Identifier of the Project, unique within its tenant"),
 		field.String("parent_proj_id").
 			Default("").
-			NotEmpty().
 			Comment("Identifier of the parent Project"),
+		field.String("path").
+			MaxLen(768).
+			Default("").
+			Comment("Materialized path of the Project made of the ancestor IDs from the root, like /root/parent/self/"),
+		field.Int("depth").
+			NonNegative().
+			Default(0).
+			Comment("Number of ancestors above the Project, 0 for a root"),
 		field.String("desc").
 			Default("").
 			Comment("Optional description of the Project"),
@@ -31,16 +51,46 @@ func (Project) Fields() []ent.Field {
 			Comment("Geographical location description (province, city, district)"),
 		field.Other("coordinate", &Point{}).
 			SchemaType(map[string]string{
-				"mysql": "POINT", // Specify the MySQL type
+				dialect.MySQL:    "POINT SRID 4326",      // A spatial index is only used for a column restricted to one SRID
+				dialect.Postgres: "geometry(Point,4326)", // Requires the PostGIS extension
+				dialect.SQLite:   "TEXT",                 // Stored as WKT and filtered in the process
 			}).
 			Comment("Geographical coordinates (latitude, longitude)"),
+		// A spatial index requires a column without NULL values in MySQL, so the boundary is not indexed
+		field.Other("boundary", &Polygon{}).
+			SchemaType(map[string]string{
+				dialect.MySQL:    "POLYGON SRID 4326",
+				dialect.Postgres: "geometry(Polygon,4326)",
+				dialect.SQLite:   "TEXT",
+			}).
+			Optional().
+			Comment("Optional boundary of the site covered by the Project"),
+		field.Bool("deleted").
+			Default(false).
+			Comment("Whether the Project has been soft deleted"),
+		field.Time("deleted_at").
+			Optional().
+			Nillable().
+			Comment("Timestamp when the Project was soft deleted, the retention period of the trash starts from it"),
+		field.String("delete_group").
+			Optional().
+			MaxLen(36).
+			Comment("Identifier shared by the Projects soft deleted together by a cascading delete, they are restored together"),
+		field.String("import_id").
+			Optional().
+			MaxLen(64).
+			Comment("Identifier of the bulk import that last wrote the Project, importing again under it skips the Project"),
+		field.Int64("version").
+			Positive().
+			Default(1).
+			Comment("Version of the row, increased by every write so that concurrent writers can detect each other"),
 		field.Time("create_time").
-			DefaultNow().
+			Default(time.Now).
 			Immutable().
 			Comment("Timestamp when the Project was created"),
 		field.Time("last_update").
-			DefaultNow().
-			UpdateDefaultNow().
+			Default(time.Now).
+			UpdateDefault(time.Now).
 			Comment("Timestamp when the Project was last updated"),
 	}
 }
@@ -53,10 +103,24 @@ func (Project) Edges() []ent.Edge {
 // Indexes of the Project.
 func (Project) Indexes() []ent.Index {
 	return []ent.Index{
-		index.Fields("parent_proj_id").
-			Comment("Index to optimize Project tree queries"),
+		// Project IDs are only unique within a tenant
+		index.Fields("tenant_id", "project_id").
+			Unique(),
+		// Index to optimize Project tree queries
+		index.Fields("tenant_id", "parent_proj_id"),
+		// Index to optimize ancestor and descendant lookups by path prefix. The key of InnoDB is limited to 3072
+		// bytes, which the whole path of 768 characters of 4 bytes exceeds, so only the start of the path is indexed
+		index.Fields("tenant_id", "path").
+			Annotations(entsql.PrefixColumn("path", pathIndexPrefix)),
+		// Index to optimize the radius, nearest and bounding box queries
+		index.Fields("coordinate").
+			Annotations(entsql.IndexTypes(map[string]string{
+				dialect.MySQL:    "SPATIAL",
+				dialect.Postgres: "GIST",
+			})),
 	}
 }
+
 func (Project) Annotations() []schema.Annotation {
 	return []schema.Annotation{
 		entsql.WithComments(true),
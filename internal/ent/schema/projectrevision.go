@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// ProjectRevision holds the schema definition for the ProjectRevision entity, which is the state of a Project
+// right after one of its changes.
+type ProjectRevision struct {
+	ent.Schema
+}
+
+// Fields of the ProjectRevision.
+func (ProjectRevision) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("tenant_id").
+			MaxLen(64).
+			Default("").
+			Immutable().
+			Comment("Identifier of the tenant of the Project, empty for the default tenant"),
+		field.String("project_id").
+			NotEmpty().
+			Immutable().
+			Comment("Identifier of the Project"),
+		field.Int64("revision").
+			Positive().
+			Immutable().
+			Comment("Number of the revision, starting from 1 and increasing with every change of the Project"),
+		field.Text("snapshot").
+			Immutable().
+			Comment("JSON snapshot of the Project right after the change"),
+		field.Enum("operation").
+			Values("create", "update", "delete", "restore", "move", "revert").
+			Immutable().
+			Comment("Kind of the change that made the revision"),
+		field.String("actor").
+			Default("").
+			Immutable().
+			Comment("Subject of the caller who made the change, empty for the changes made by the service itself"),
+		field.Time("create_time").
+			Default(time.Now).
+			Immutable().
+			Comment("Timestamp of the change"),
+	}
+}
+
+// Edges of the ProjectRevision.
+func (ProjectRevision) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes of the ProjectRevision.
+func (ProjectRevision) Indexes() []ent.Index {
+	return []ent.Index{
+		// A revision number is only used once per Project
+		index.Fields("tenant_id", "project_id", "revision").
+			Unique(),
+		// Index to optimize the point-in-time reads
+		index.Fields("tenant_id", "project_id", "create_time"),
+	}
+}
+
+func (ProjectRevision) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entsql.WithComments(true),
+		entsql.Annotation{
+			Table:     "project_revisions",
+			Charset:   "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+			Options:   "ENGINE = InnoDB",
+		},
+		schema.Comment("Revision history of the projects"),
+	}
+}
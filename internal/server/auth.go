@@ -0,0 +1,312 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/golang-jwt/jwt/v5"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/conf"
+)
+
+// Scopes granting access to the operations of the service
+const (
+	scopeRead  = "project:read"
+	scopeWrite = "project:write"
+	scopeAdmin = biz.ScopeAdmin
+)
+
+// operationScopes maps every operation to the scope it requires. Operations missing from the table require
+// the admin scope, so that an operation added later is never exposed by mistake. The scopes only gate the
+// operations, the projects they apply to are further checked against the roles of the caller by the biz layer.
+var operationScopes = map[string]string{
+	v1.ProjectManagement_ListProjects_FullMethodName:                scopeRead,
+	v1.ProjectManagement_ListDeletedProjects_FullMethodName:         scopeRead,
+	v1.ProjectManagement_GetProject_FullMethodName:                  scopeRead,
+	v1.ProjectManagement_SearchBranchProjects_FullMethodName:        scopeRead,
+	v1.ProjectManagement_FindNearbyProjects_FullMethodName:          scopeRead,
+	v1.ProjectManagement_GetProjectSubtree_FullMethodName:           scopeRead,
+	v1.ProjectManagement_FindNearestProjects_FullMethodName:         scopeRead,
+	v1.ProjectManagement_FindProjectsInBounds_FullMethodName:        scopeRead,
+	v1.ProjectManagement_FindProjectsInPolygon_FullMethodName:       scopeRead,
+	v1.ProjectManagement_FindProjectsContainingPoint_FullMethodName: scopeRead,
+	v1.ProjectManagement_ExportProjectsGeoJSON_FullMethodName:       scopeRead,
+	v1.ProjectManagement_ExportProjects_FullMethodName:              scopeRead,
+	v1.ProjectManagement_CreateProject_FullMethodName:               scopeWrite,
+	v1.ProjectManagement_UpdateProject_FullMethodName:               scopeWrite,
+	v1.ProjectManagement_DeleteProject_FullMethodName:               scopeWrite,
+	v1.ProjectManagement_RestoreProject_FullMethodName:              scopeWrite,
+	v1.ProjectManagement_MoveProject_FullMethodName:                 scopeWrite,
+	v1.ProjectManagement_ImportProjectsGeoJSON_FullMethodName:       scopeWrite,
+	v1.ProjectManagement_BatchCreateProjects_FullMethodName:         scopeWrite,
+	v1.ProjectManagement_BatchUpdateProjects_FullMethodName:         scopeWrite,
+	v1.ProjectManagement_BatchDeleteProjects_FullMethodName:         scopeWrite,
+	v1.ProjectManagement_GrantRole_FullMethodName:                   scopeWrite,
+	v1.ProjectManagement_RevokeRole_FullMethodName:                  scopeWrite,
+	v1.ProjectManagement_ListEffectivePermissions_FullMethodName:    scopeRead,
+	v1.ProjectManagement_ListAuditEvents_FullMethodName:             scopeRead,
+	v1.ProjectManagement_ListProjectRevisions_FullMethodName:        scopeRead,
+	v1.ProjectManagement_GetProjectRevision_FullMethodName:          scopeRead,
+	v1.ProjectManagement_RevertProject_FullMethodName:               scopeWrite,
+	v1.ProjectManagement_PurgeProject_FullMethodName:                scopeAdmin,
+	v1.ProjectManagement_ImportProjects_FullMethodName:              scopeAdmin,
+	v1.ProjectManagement_RebuildProjectFilter_FullMethodName:        scopeAdmin,
+}
+
+// publicOperations are always served without a token. The `/metrics` endpoint is not listed since it is
+// registered on the HTTP server directly and never goes through the middlewares.
+var publicOperations = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+}
+
+// tokenClaims are the claims read from the tokens. The scopes are either a space-separated `scope` string
+// (RFC 8693) or a `scp` array, depending on the identity provider. The groups of the caller are listed by
+// the `groups` claim, and its tenant is named by the `tenant` claim.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope  string   `json:"scope,omitempty"`
+	Scp    []string `json:"scp,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// scopes returns the scopes granted by the claims.
+func (c *tokenClaims) scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// NewAuthMiddleware authenticates the callers with the JSON Web Tokens carried by the `Authorization` header
+// of both HTTP requests and GRPC metadata, and checks that their scopes allow the operation they call.
+//
+// The actor described by the token is stored in the context for the service. A missing or invalid token is
+// rejected with the reason UNAUTHENTICATED, and a token lacking the scope with PERMISSION_DENIED.
+func NewAuthMiddleware(c *conf.Auth) (middleware.Middleware, error) {
+	keys, err := loadVerificationKeys(c)
+	if err != nil {
+		return nil, err
+	}
+	public := make(map[string]bool)
+	for _, op := range append(publicOperations, c.PublicOperations...) {
+		public[op] = true
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(keys.methods())}
+	if c.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(c.Issuer))
+	}
+	if c.Audience != "" {
+		opts = append(opts, jwt.WithAudience(c.Audience))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok || public[tr.Operation()] {
+				return handler(ctx, req)
+			}
+			raw, found := strings.CutPrefix(tr.RequestHeader().Get("Authorization"), "Bearer ")
+			if !found || raw == "" {
+				return nil, v1.ErrorUnauthenticated("Missing bearer token")
+			}
+			var claims tokenClaims
+			if _, err := parser.ParseWithClaims(raw, &claims, keys.lookup); err != nil {
+				return nil, v1.ErrorUnauthenticated("Invalid token: %v", err)
+			}
+
+			actor := &biz.Actor{Subject: claims.Subject, Scopes: claims.scopes(), Groups: claims.Groups, Tenant: claims.Tenant}
+			scope, listed := operationScopes[tr.Operation()]
+			if !listed {
+				scope = scopeAdmin
+			}
+			// The admin scope grants every other scope
+			if !actor.HasScope(scope) && !actor.HasScope(scopeAdmin) {
+				return nil, v1.ErrorPermissionDenied("The scope %v is required to call %v", scope, tr.Operation())
+			}
+			return handler(biz.NewActorContext(ctx, actor), req)
+		}
+	}, nil
+}
+
+// verificationKeys are the keys the signatures of the tokens are verified with.
+type verificationKeys struct {
+	hmac []byte
+	// public holds the RSA and ECDSA public keys, byID the subset that comes with a key ID
+	public []interface{}
+	byID   map[string]interface{}
+}
+
+// loadVerificationKeys reads the keys from the config and the JWKS file it points to.
+func loadVerificationKeys(c *conf.Auth) (*verificationKeys, error) {
+	keys := &verificationKeys{byID: make(map[string]interface{})}
+	if c.HmacSecret != "" {
+		keys.hmac = []byte(c.HmacSecret)
+	}
+	for i, pem := range c.PublicKeys {
+		key, err := parsePublicKey([]byte(pem))
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %w", i, err)
+		}
+		keys.public = append(keys.public, key)
+	}
+	if c.JwksFile != "" {
+		raw, err := os.ReadFile(c.JwksFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = keys.addJWKS(raw); err != nil {
+			return nil, fmt.Errorf("%v: %w", c.JwksFile, err)
+		}
+	}
+	if keys.hmac == nil && len(keys.public) == 0 {
+		return nil, errors.New("the authentication is enabled without any key to verify the tokens")
+	}
+	return keys, nil
+}
+
+// parsePublicKey parses a PEM encoded RSA or ECDSA public key.
+func parsePublicKey(pem []byte) (interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	return jwt.ParseECPublicKeyFromPEM(pem)
+}
+
+// methods lists the signing methods the keys can verify. Any other method, `none` above all, is rejected.
+func (k *verificationKeys) methods() []string {
+	var methods []string
+	if k.hmac != nil {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	var hasRSA, hasEC bool
+	for _, key := range k.public {
+		switch key.(type) {
+		case *rsa.PublicKey:
+			hasRSA = true
+		case *ecdsa.PublicKey:
+			hasEC = true
+		}
+	}
+	if hasRSA {
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	}
+	if hasEC {
+		methods = append(methods, "ES256", "ES384", "ES512")
+	}
+	return methods
+}
+
+// lookup is the [jwt.Keyfunc] returning the keys that may have signed the token. A token carrying a known
+// key ID is only verified with that key, other tokens are tried against every key of their kind.
+func (k *verificationKeys) lookup(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return k.hmac, nil
+	}
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, found := k.byID[kid]; found {
+			return key, nil
+		}
+	}
+	set := jwt.VerificationKeySet{}
+	for _, key := range k.public {
+		set.Keys = append(set.Keys, key)
+	}
+	return set, nil
+}
+
+// jsonWebKey is a key of a JWKS document (RFC 7517), only the members of RSA and EC public keys are read.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// addJWKS adds the signature keys of a JWKS document. Encryption keys and unsupported key types are skipped.
+func (k *verificationKeys) addJWKS(raw []byte) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaPublicKey()
+		case "EC":
+			key, err = jwk.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		k.public = append(k.public, key)
+		if jwk.Kid != "" {
+			k.byID[jwk.Kid] = key
+		}
+	}
+	return nil
+}
+
+func (jwk *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func (jwk *jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("the point is not on the curve")
+	}
+	return key, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"project/internal/conf"
+)
+
+// bloomRetryInterval is the interval between two attempts to build the Bloom filter until one succeeds
+const bloomRetryInterval = time.Minute
+
+// FilterServer builds the Bloom filter of the project IDs when the application starts, and rebuilds it
+// periodically when a rebuild interval is configured.
+//
+// Like [PurgeServer], it runs alongside the HTTP and GRPC servers as a [transport.Server] of the application.
+type FilterServer struct {
+	mgr      *biz.ProjectManager
+	interval time.Duration
+	stop     chan struct{}
+	// stopOnce closes stop once, however many times the server is stopped
+	stopOnce sync.Once
+}
+
+func NewFilterServer(c *conf.Data, mgr *biz.ProjectManager) *FilterServer {
+	s := &FilterServer{mgr: mgr, stop: make(chan struct{})}
+	if c.Bloom != nil {
+		s.interval = c.Bloom.RebuildInterval.AsDuration()
+	}
+	return s
+}
+
+// Start builds the filter right away, then rebuilds it on every tick until the server is stopped.
+// A failed build is retried sooner, since the lookups bypass the filter until it is built.
+func (s *FilterServer) Start(ctx context.Context) error {
+	for {
+		wait := s.interval
+		if err := s.rebuild(ctx); err != nil && (wait <= 0 || wait > bloomRetryInterval) {
+			wait = bloomRetryInterval
+		}
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *FilterServer) Stop(context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *FilterServer) rebuild(ctx context.Context) error {
+	items, err := s.mgr.RebuildProjectFilter(ctx)
+	if v1.IsConflict(err) {
+		// The filter rebuilt by another instance is shared with this one
+		log.Info("the Bloom filter of project IDs is being rebuilt by another instance")
+		return nil
+	}
+	if err != nil {
+		log.Errorf("failed to build the Bloom filter of project IDs: %v", err)
+		return err
+	}
+	log.Infof("built the Bloom filter of project IDs with %d items", items)
+	return nil
+}
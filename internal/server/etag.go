@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	v1 "project/api/project/v1"
+)
+
+// etagger is implemented by the replies that carry the entity tag of a project.
+type etagger interface {
+	GetEtag() string
+}
+
+// NewETagMiddleware maps the conditional requests of HTTP onto the entity tags carried by the messages.
+//
+// The If-Match header of an update or a delete stands for the entity tag of the request when the body leaves it
+// empty, "If-Match: *" being the same as no condition. The entity tag of a reply is returned in the ETag header.
+func NewETagMiddleware() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok || tr.Kind() != transport.KindHTTP {
+				return handler(ctx, req)
+			}
+			if match := strings.TrimSpace(tr.RequestHeader().Get("If-Match")); match != "" && match != "*" {
+				switch r := req.(type) {
+				case *v1.UpdateProjectRequest:
+					if r.Etag == "" {
+						r.Etag = match
+					}
+				case *v1.DeleteProjectRequest:
+					if r.Etag == "" {
+						r.Etag = match
+					}
+				}
+			}
+
+			reply, err := handler(ctx, req)
+			if r, ok := reply.(etagger); ok && err == nil && r.GetEtag() != "" {
+				tr.ReplyHeader().Set("ETag", r.GetEtag())
+			}
+			return reply, err
+		}
+	}
+}
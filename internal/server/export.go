@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	nethttp "net/http"
+	v1 "project/api/project/v1"
+	"project/internal/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/encoding"
+	"github.com/go-kratos/kratos/v2/encoding/json"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exportFlushRows is the number of rows written between two flushes of the response, so that the client receives
+// the rows as they are read rather than once the export is over
+const exportFlushRows = 100
+
+// csvHeader names the columns of the CSV exports
+var csvHeader = []string{
+	"project_id", "parent_proj_id", "path", "depth", "desc", "location", "latitude", "longitude",
+	"create_time", "last_update", "delete_time",
+}
+
+// rowWriter writes the exported projects in one of the download formats.
+type rowWriter interface {
+	contentType() string
+	write(row *v1.ExportedProject) error
+	flush() error
+}
+
+// registerExportRoutes registers the HTTP endpoints downloading the projects as CSV or NDJSON files, the format
+// being the last segment of the path.
+//
+// The rows are streamed as they are read, so a failure once the download has started cannot be reported with an
+// error status anymore, and the response is cut short instead. The query parameters are the filters of
+// [v1.ExportProjectsRequest], and the routes go through the same middlewares as the other routes.
+func registerExportRoutes(srv *http.Server, s *service.ProjectService) {
+	r := srv.Route("/")
+	// Export the projects matching the filters
+	r.GET("/terminal/export/{format}", func(ctx http.Context) error {
+		var in v1.ExportProjectsRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		return exportRows(ctx, s, &in)
+	})
+	// Export a project and its descendants matching the filters
+	r.GET("/terminal/{project_id}/export/{format}", func(ctx http.Context) error {
+		var in v1.ExportProjectsRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		in.SubtreeRootId = ctx.Vars().Get("project_id")
+		return exportRows(ctx, s, &in)
+	})
+}
+
+// exportRows runs the export through the middlewares and streams the rows as the response body.
+func exportRows(ctx http.Context, s *service.ProjectService, in *v1.ExportProjectsRequest) error {
+	format := ctx.Vars().Get("format")
+	w, err := newRowWriter(format, ctx.Response())
+	if err != nil {
+		return err
+	}
+	// The status and the headers are sent with the first row, once the export is known to succeed so far
+	started := false
+	start := func() {
+		started = true
+		header := ctx.Response().Header()
+		header.Set("Content-Type", w.contentType())
+		header.Set("Content-Disposition", `attachment; filename="projects.`+format+`"`)
+		ctx.Response().WriteHeader(nethttp.StatusOK)
+	}
+
+	http.SetOperation(ctx, v1.ProjectManagement_ExportProjects_FullMethodName)
+	h := ctx.Middleware(func(c context.Context, req interface{}) (interface{}, error) {
+		rows := 0
+		return nil, s.ExportProjectRows(c, req.(*v1.ExportProjectsRequest), func(row *v1.ExportedProject) error {
+			if !started {
+				start()
+			}
+			if err := w.write(row); err != nil {
+				return err
+			}
+			if rows++; rows%exportFlushRows == 0 {
+				return w.flush()
+			}
+			return nil
+		})
+	})
+	if _, err = h(ctx, in); err != nil {
+		if started {
+			// The status is already sent, aborting the response tells the client that the file is incomplete
+			panic(nethttp.ErrAbortHandler)
+		}
+		return err
+	}
+	if !started {
+		start()
+	}
+	return w.flush()
+}
+
+// newRowWriter returns the writer of the format, either `csv` or `ndjson`.
+func newRowWriter(format string, res nethttp.ResponseWriter) (rowWriter, error) {
+	switch format {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(res), res: res}, nil
+	case "ndjson":
+		return &ndjsonWriter{codec: encoding.GetCodec(json.Name), res: res}, nil
+	default:
+		return nil, v1.ErrorMalformedInput("Unknown export format %q, expecting csv or ndjson", format)
+	}
+}
+
+// csvWriter writes one line per project, preceded by the header line.
+type csvWriter struct {
+	w          *csv.Writer
+	res        nethttp.ResponseWriter
+	headerDone bool
+}
+
+func (c *csvWriter) contentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (c *csvWriter) write(row *v1.ExportedProject) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	p := row.Project
+	return c.w.Write([]string{
+		escapeFormula(p.ProjectId),
+		escapeFormula(p.ParentProjId),
+		escapeFormula(row.Path),
+		strconv.Itoa(int(p.Depth)),
+		escapeFormula(p.Desc),
+		escapeFormula(p.Location),
+		strconv.FormatFloat(p.GetCoordinate().GetLatitude(), 'f', -1, 64),
+		strconv.FormatFloat(p.GetCoordinate().GetLongitude(), 'f', -1, 64),
+		formatTimestamp(p.CreateTime),
+		formatTimestamp(p.LastUpdate),
+		formatTimestamp(p.DeleteTime),
+	})
+}
+
+// escapeFormula keeps a spreadsheet from evaluating the text of a cell as a formula, which the text written by the
+// callers could otherwise smuggle into the export (CSV injection). A cell starting with one of the characters that
+// start a formula is prefixed with a single quote, as recommended by OWASP. The numbers are written by the service,
+// so they are left alone, negative ones included.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// flush writes the header of an empty export as well, so that the file always names its columns.
+func (c *csvWriter) flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	flushResponse(c.res)
+	return nil
+}
+
+// writeHeader writes the header line unless it is already written.
+func (c *csvWriter) writeHeader() error {
+	if c.headerDone {
+		return nil
+	}
+	c.headerDone = true
+	return c.w.Write(csvHeader)
+}
+
+// ndjsonWriter writes one JSON object per line, encoded like the responses of the other routes.
+type ndjsonWriter struct {
+	codec encoding.Codec
+	res   nethttp.ResponseWriter
+}
+
+func (n *ndjsonWriter) contentType() string {
+	return "application/x-ndjson"
+}
+
+func (n *ndjsonWriter) write(row *v1.ExportedProject) error {
+	line, err := n.codec.Marshal(row)
+	if err != nil {
+		return err
+	}
+	_, err = n.res.Write(append(line, '\n'))
+	return err
+}
+
+func (n *ndjsonWriter) flush() error {
+	flushResponse(n.res)
+	return nil
+}
+
+// flushResponse sends the buffered part of the response to the client.
+func flushResponse(res nethttp.ResponseWriter) {
+	if f, ok := res.(nethttp.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// formatTimestamp formats the timestamp in RFC 3339, an unset timestamp making an empty cell.
+func formatTimestamp(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return t.AsTime().Format(time.RFC3339)
+}
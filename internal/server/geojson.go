@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"io"
+	v1 "project/api/project/v1"
+	"project/internal/service"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// geoJSONContentType is the media type of GeoJSON documents (RFC 7946)
+const geoJSONContentType = "application/geo+json"
+
+// registerGeoJSONRoutes registers the HTTP endpoints exchanging GeoJSON documents.
+//
+// The generated routes would wrap the documents in JSON messages, so these routes are written by hand and send
+// or receive the bare FeatureCollection instead. They still go through the same middlewares as the other routes.
+func registerGeoJSONRoutes(srv *http.Server, s *service.ProjectService) {
+	r := srv.Route("/")
+	// Export a project and its descendants
+	r.GET("/terminal/{project_id}/geojson", func(ctx http.Context) error {
+		var in v1.GetProjectSubtreeRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		if err := ctx.BindVars(&in); err != nil {
+			return err
+		}
+		return exportGeoJSON(ctx, s, &v1.ExportProjectsGeoJSONRequest{
+			Source: &v1.ExportProjectsGeoJSONRequest_Subtree{Subtree: &in},
+		})
+	})
+	// Export the results of any of the queries, selected in the request body
+	r.POST("/terminal/geojson/export", func(ctx http.Context) error {
+		var in v1.ExportProjectsGeoJSONRequest
+		if err := ctx.Bind(&in); err != nil {
+			return err
+		}
+		return exportGeoJSON(ctx, s, &in)
+	})
+	// Import the FeatureCollection sent as the request body
+	r.POST("/terminal/geojson/import", func(ctx http.Context) error {
+		content, err := io.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return err
+		}
+		http.SetOperation(ctx, v1.ProjectManagement_ImportProjectsGeoJSON_FullMethodName)
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return s.ImportProjectsGeoJSON(ctx, req.(*v1.ImportProjectsGeoJSONRequest))
+		})
+		out, err := h(ctx, &v1.ImportProjectsGeoJSONRequest{Content: content})
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	})
+}
+
+// exportGeoJSON runs the export through the middlewares and writes the document as the response body.
+func exportGeoJSON(ctx http.Context, s *service.ProjectService, in *v1.ExportProjectsGeoJSONRequest) error {
+	http.SetOperation(ctx, v1.ProjectManagement_ExportProjectsGeoJSON_FullMethodName)
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.ExportProjectsGeoJSON(ctx, req.(*v1.ExportProjectsGeoJSONRequest))
+	})
+	out, err := h(ctx, in)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(200, geoJSONContentType, out.(*v1.GeoJSONDocument).Content)
+}
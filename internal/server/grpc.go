@@ -15,6 +15,8 @@ func NewGRPCServer(
 	c *conf.Server, s *service.ProjectService, m Middlewares) *grpc.Server {
 	var opts = []grpc.ServerOption{
 		grpc.Middleware(m...),
+		// The middlewares only apply to the unary calls, the streams run them through an interceptor
+		grpc.StreamInterceptor(NewStreamInterceptor(m)),
 	}
 	if c.Grpc.Network != "" {
 		opts = append(opts, grpc.Network(c.Grpc.Network))
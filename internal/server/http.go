@@ -31,6 +31,8 @@ func NewHTTPServer(c *conf.Server, s *service.ProjectService, m Middlewares) *ht
 	// Instantiate a new HTTP server listening to a specific port to serve the requests.
 	srv := http.NewServer(opts...)
 	srv.Handle("/metrics", promhttp.Handler())     // We shall register the Prometheus handler to the server as well
+	registerGeoJSONRoutes(srv, s)                  // GeoJSON documents are exchanged without the JSON message wrapper
+	registerExportRoutes(srv, s)                   // CSV and NDJSON downloads are streamed row by row
 	v1.RegisterProjectManagementHTTPServer(srv, s) // Register the service handlers as well
 	return srv
 }
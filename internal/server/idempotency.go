@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+// idempotencyKeyHeader carries the idempotency key of a request, either as an HTTP header or as GRPC metadata
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyReplayedHeader is set on the replies replayed from an earlier request with the same idempotency key
+const idempotencyReplayedHeader = "Idempotency-Replayed"
+
+// maxIdempotencyKeyLength bounds the idempotency keys accepted from the callers
+const maxIdempotencyKeyLength = 255
+
+// idempotentOperations are the operations changing the projects, whose requests may carry an idempotency key.
+// The key of any other operation is ignored, since repeating them is harmless anyway.
+var idempotentOperations = map[string]bool{
+	v1.ProjectManagement_CreateProject_FullMethodName:         true,
+	v1.ProjectManagement_UpdateProject_FullMethodName:         true,
+	v1.ProjectManagement_DeleteProject_FullMethodName:         true,
+	v1.ProjectManagement_RestoreProject_FullMethodName:        true,
+	v1.ProjectManagement_MoveProject_FullMethodName:           true,
+	v1.ProjectManagement_ImportProjectsGeoJSON_FullMethodName: true,
+	v1.ProjectManagement_BatchCreateProjects_FullMethodName:   true,
+	v1.ProjectManagement_BatchUpdateProjects_FullMethodName:   true,
+	v1.ProjectManagement_BatchDeleteProjects_FullMethodName:   true,
+	v1.ProjectManagement_GrantRole_FullMethodName:             true,
+	v1.ProjectManagement_RevokeRole_FullMethodName:            true,
+	v1.ProjectManagement_RevertProject_FullMethodName:         true,
+	v1.ProjectManagement_PurgeProject_FullMethodName:          true,
+}
+
+// NewIdempotencyMiddleware makes the retries of the requests carrying the same Idempotency-Key safe, such as the
+// ones sent again by a client that lost the reply of the first request.
+//
+// The reply of the first request is stored for the configured window, and the retries are answered with it
+// instead of being applied again, with the Idempotency-Replayed header set. A key reused with another operation
+// or another payload is rejected with the reason IDEMPOTENCY_KEY_REUSED, while a retry arriving before the first
+// request completes is rejected with CONFLICT, the first request keeping its claim on the key however long it runs.
+// A failed request does not keep its key, so its retries are applied.
+//
+// The keys are scoped by the tenant and the caller. When the replies cannot be stored, the requests are served
+// without the guarantee rather than rejected.
+func NewIdempotencyMiddleware(repo biz.IdempotencyRepository) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok || !idempotentOperations[tr.Operation()] {
+				return handler(ctx, req)
+			}
+			key := tr.RequestHeader().Get(idempotencyKeyHeader)
+			msg, ok := req.(proto.Message)
+			if key == "" || !ok {
+				return handler(ctx, req)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return nil, v1.ErrorMalformedInput("The idempotency key exceeds %d characters", maxIdempotencyKeyLength)
+			}
+			fingerprint, err := requestFingerprint(tr.Operation(), msg)
+			if err != nil {
+				return nil, err
+			}
+			if actor, ok := biz.ActorFromContext(ctx); ok {
+				key = actor.Subject + ":" + key
+			}
+
+			claim, record, err := repo.Reserve(ctx, key, fingerprint)
+			if err != nil {
+				log.Warnf("failed to reserve the idempotency key %v: %v", key, err)
+				return handler(ctx, req)
+			}
+			if record != nil {
+				return replayReply(tr, record, fingerprint)
+			}
+
+			// The key is settled even when the caller gives up, so that the retries find it
+			settleCtx := context.WithoutCancel(ctx)
+			stop := keepClaim(settleCtx, repo, key, claim)
+			reply, err := handler(ctx, req)
+			stop()
+			if err != nil {
+				if rerr := repo.Release(settleCtx, key, claim); rerr != nil {
+					log.Warnf("failed to release the idempotency key %v: %v", key, rerr)
+				}
+				return reply, err
+			}
+			encoded, err := encodeReply(reply)
+			if err == nil {
+				err = repo.Complete(settleCtx, key, claim, &biz.IdempotencyRecord{Fingerprint: fingerprint, Reply: encoded})
+			}
+			if err != nil {
+				log.Warnf("failed to store the reply of the idempotency key %v: %v", key, err)
+			}
+			return reply, nil
+		}
+	}
+}
+
+// keepClaim extends the claim of the request on the idempotency key until the returned function is called, so that
+// a request running longer than [biz.IdempotencyClaimTTL] keeps its key. The claim is extended three times per
+// lifetime, which leaves room for an extension to fail and be tried again on the next tick. A request that lost its
+// claim anyway runs on, but it then neither completes nor releases the key, which a retry may have claimed since.
+func keepClaim(ctx context.Context, repo biz.IdempotencyRepository, key, claim string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(biz.IdempotencyClaimTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := repo.Extend(ctx, key, claim); err != nil {
+					log.Warnf("failed to extend the claim on the idempotency key %v: %v", key, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// requestFingerprint identifies the operation together with the payload of the request.
+func requestFingerprint(operation string, req proto.Message) (string, error) {
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(operation))
+	h.Write([]byte{0})
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// encodeReply encodes the reply together with its type, so that [replayReply] can decode it without knowing it.
+func encodeReply(reply interface{}) ([]byte, error) {
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("the reply %T is not a protocol buffers message", reply)
+	}
+	packed, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(packed)
+}
+
+// replayReply answers a retry with the reply of the request that claimed the idempotency key first.
+func replayReply(tr transport.Transporter, record *biz.IdempotencyRecord, fingerprint string) (interface{}, error) {
+	if record.Fingerprint != fingerprint {
+		return nil, v1.ErrorIdempotencyKeyReused("The idempotency key was already used by a request with another payload")
+	}
+	if record.Reply == nil {
+		return nil, v1.ErrorConflict("A request with the same idempotency key is still in progress")
+	}
+	packed := &anypb.Any{}
+	if err := proto.Unmarshal(record.Reply, packed); err != nil {
+		return nil, err
+	}
+	reply, err := packed.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	tr.ReplyHeader().Set(idempotencyReplayedHeader, "true")
+	return reply, nil
+}
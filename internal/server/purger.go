@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"project/internal/biz"
+	"project/internal/conf"
+)
+
+// defaultPurgeInterval is the interval between two purges when the config leaves it out
+const defaultPurgeInterval = time.Hour
+
+// PurgeServer periodically purges the projects that have stayed in the trash longer than the retention period.
+//
+// It runs alongside the HTTP and GRPC servers as a [transport.Server] of the application, so it starts and stops
+// together with them.
+type PurgeServer struct {
+	mgr       *biz.ProjectManager
+	retention time.Duration
+	interval  time.Duration
+	stop      chan struct{}
+	// stopOnce closes stop once, however many times the server is stopped
+	stopOnce sync.Once
+}
+
+func NewPurgeServer(c *conf.Data, mgr *biz.ProjectManager) *PurgeServer {
+	s := &PurgeServer{mgr: mgr, interval: defaultPurgeInterval, stop: make(chan struct{})}
+	if c.Trash != nil {
+		s.retention = c.Trash.Retention.AsDuration()
+		if c.Trash.PurgeInterval != nil && c.Trash.PurgeInterval.AsDuration() > 0 {
+			s.interval = c.Trash.PurgeInterval.AsDuration()
+		}
+	}
+	return s
+}
+
+// Start purges the expired projects on every tick until the server is stopped.
+// Without a retention period the projects are kept in the trash forever and nothing is purged.
+func (s *PurgeServer) Start(ctx context.Context) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.purge(ctx)
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *PurgeServer) Stop(context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return nil
+}
+
+// purge hard deletes the projects deleted before the retention period.
+// Failures are only logged, the projects are purged again on the next tick.
+func (s *PurgeServer) purge(ctx context.Context) {
+	purged, err := s.mgr.PurgeExpired(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		log.Errorf("failed to purge the expired projects: %v", err)
+	}
+	if purged > 0 {
+		log.Infof("purged %d expired projects from the trash", purged)
+	}
+}
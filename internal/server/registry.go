@@ -2,14 +2,17 @@ package server
 
 import (
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/registry"
 	"project/internal/conf"
 
 	etcdclient "go.etcd.io/etcd/client/v3"
 )
 
-func NewRegistry(c *conf.Registry) registry.Registrar {
-	etcdClient, err := etcdclient.New(etcdclient.Config{ // Here we instantiate an etcd client
+// NewEtcdClient connects to the etcd cluster, which serves as the registry of the service and leases the worker
+// IDs of the Snowflake project IDs as well
+func NewEtcdClient(c *conf.Registry) (client *etcdclient.Client, cleanup func(), err error) {
+	client, err = etcdclient.New(etcdclient.Config{ // Here we instantiate an etcd client
 		Endpoints:            c.Endpoints,
 		Username:             c.Username,
 		Password:             c.Password,
@@ -18,7 +21,17 @@ func NewRegistry(c *conf.Registry) registry.Registrar {
 		DialKeepAliveTimeout: c.DialKeepAliveTimeout.AsDuration(),
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	return etcd.New(etcdClient)
+	cleanup = func() {
+		log.Info("closing the connection to etcd")
+		if err := client.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+	return
+}
+
+func NewRegistry(client *etcdclient.Client) registry.Registrar {
+	return etcd.New(client)
 }
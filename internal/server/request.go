@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/google/uuid"
+	"project/internal/biz"
+)
+
+// requestIDHeader carries the ID of the request, both in the request and in the reply
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs accepted from the callers, longer IDs are replaced by generated ones
+const maxRequestIDLength = 128
+
+// NewRequestIDMiddleware identifies every request, so that the changes it makes can be traced back to it.
+//
+// The ID given by the caller in the X-Request-ID header is kept, which lets a gateway or a client correlate its
+// own logs with the audit log, otherwise a new ID is generated. Either way it is returned in the same header.
+func NewRequestIDMiddleware() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			id := tr.RequestHeader().Get(requestIDHeader)
+			if id == "" || len(id) > maxRequestIDLength {
+				id = uuid.NewString()
+			}
+			tr.ReplyHeader().Set(requestIDHeader, id)
+			return handler(biz.NewRequestIDContext(ctx, id), req)
+		}
+	}
+}
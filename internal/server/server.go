@@ -5,19 +5,21 @@ import (
 	"github.com/go-kratos/kratos/v2/middleware/ratelimit"
 	"github.com/go-kratos/kratos/v2/middleware/recovery"
 	"github.com/google/wire"
+	"project/internal/biz"
 	"project/internal/conf"
 )
 
 // ProviderSet is server providers.
 var ProviderSet = wire.NewSet(
 	NewGRPCServer, NewHTTPServer,
-	NewRegistry, NewMiddlewares,
+	NewEtcdClient, NewRegistry, NewMiddlewares,
+	NewPurgeServer, NewFilterServer,
 )
 
 type Middlewares []middleware.Middleware
 
-func NewMiddlewares(c *conf.Telemetry) (m Middlewares) {
-	m = make(Middlewares, 0, 4)
+func NewMiddlewares(c *conf.Telemetry, a *conf.Auth, idempotency biz.IdempotencyRepository) (m Middlewares, err error) {
+	m = make(Middlewares, 0, 10)
 	m = append(m,
 		// In a normal application, calling the function panic() would make the app exit.
 		// We want the service running at all time and do not stop at all, so we shall recover from the panic
@@ -36,5 +38,23 @@ func NewMiddlewares(c *conf.Telemetry) (m Middlewares) {
 	if c.Traces.Enabled {
 		m = append(m, NewTracingMiddleware(c.Traces))
 	}
+	// Every request is identified, even the rejected ones, and the changes it makes refer to its ID.
+	m = append(m, NewRequestIDMiddleware())
+	// Callers are authenticated with JSON Web Tokens, the operations they may call depend on their scopes.
+	if a.GetEnabled() {
+		var auth middleware.Middleware
+		if auth, err = NewAuthMiddleware(a); err != nil {
+			return nil, err
+		}
+		m = append(m, auth)
+	}
+	// Every request is bound to a tenant, taken from the token of the caller when there is one.
+	m = append(m, NewTenantMiddleware())
+	// Updates and deletes over HTTP may be conditioned on the If-Match header, and replies carry an ETag header.
+	m = append(m, NewETagMiddleware())
+	// Retries of the changes carrying an Idempotency-Key are answered with the reply of the first request.
+	m = append(m, NewIdempotencyMiddleware(idempotency))
+	// Requests are validated last, so that the rejected ones are still measured and traced like the others.
+	m = append(m, NewValidationMiddleware())
 	return
 }
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"google.golang.org/grpc"
+)
+
+// NewStreamInterceptor runs the middlewares once when a stream is opened, so that the streams are authenticated,
+// bound to a tenant, measured and traced like the unary calls. The handler of the stream sees the context prepared
+// by the middlewares, while the messages it receives are left to the handler to validate.
+func NewStreamInterceptor(m Middlewares) grpc.StreamServerInterceptor {
+	chain := middleware.Chain(m...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		_, err := chain(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		})(ss.Context(), nil)
+		return err
+	}
+}
+
+// contextStream is a server stream whose context is the one prepared by the middlewares.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+)
+
+// tenantHeader names the tenant of the request when the caller is not authenticated
+const tenantHeader = "X-Tenant-ID"
+
+// tenantPattern is the syntax of the tenant IDs, the same as the project IDs
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// NewTenantMiddleware binds every request to a tenant, whose projects are the only ones the request can see.
+//
+// The tenant of an authenticated caller is read from the `tenant` claim of its token and cannot be overridden,
+// while requests served without authentication name their tenant with the X-Tenant-ID header. Requests without
+// any tenant belong to the default tenant.
+func NewTenantMiddleware() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var tenant string
+			if actor, ok := biz.ActorFromContext(ctx); ok {
+				tenant = actor.Tenant
+			} else if tr, ok := transport.FromServerContext(ctx); ok {
+				tenant = tr.RequestHeader().Get(tenantHeader)
+			}
+			if tenant != "" && !tenantPattern.MatchString(tenant) {
+				return nil, v1.ErrorMalformedInput("Malformed tenant %q", tenant)
+			}
+			return handler(biz.NewTenantContext(ctx, tenant), req)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	v1 "project/api/project/v1"
+)
+
+// fieldError is implemented by the validation errors generated by protoc-gen-validate.
+// The cause of an error on an embedded message holds the errors of the fields of that message.
+type fieldError interface {
+	Field() string
+	Reason() string
+	Cause() error
+}
+
+// multiError is implemented by the errors gathering every violation found by ValidateAll.
+type multiError interface {
+	AllErrors() []error
+}
+
+// NewValidationMiddleware checks every request against the rules declared in the protocol buffers before it
+// reaches the service, for both the HTTP and the GRPC servers.
+//
+// A request breaking any rule is rejected with the reason MALFORMED_INPUT, save for the rules on the fields of the
+// project that a partial update leaves out of its mask. The metadata of the error maps the path of every offending
+// field, such as `project.coordinate.latitude`, to the rule it breaks.
+func NewValidationMiddleware() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var err error
+			switch v := req.(type) {
+			case interface{ ValidateAll() error }:
+				err = v.ValidateAll()
+			case interface{ Validate() error }:
+				err = v.Validate()
+			}
+			if err != nil {
+				violations := make(map[string]string)
+				collectViolations(violations, "", err)
+				// A partial update only has to provide the fields it changes
+				switch r := req.(type) {
+				case *v1.UpdateProjectRequest:
+					ignoreUnmasked(violations, "project.", r.GetUpdateMask().GetPaths())
+				case *v1.BatchUpdateProjectsRequest:
+					for i, u := range r.Requests {
+						ignoreUnmasked(violations, fmt.Sprintf("requests[%d].project.", i), u.GetUpdateMask().GetPaths())
+					}
+				}
+				if len(violations) > 0 {
+					return nil, v1.ErrorMalformedInput("Malformed request: %v", err).WithMetadata(violations)
+				}
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// collectViolations walks the validation error down to the fields breaking a rule, recording each of them under
+// its path below the prefix.
+func collectViolations(violations map[string]string, prefix string, err error) {
+	var multi multiError
+	if errors.As(err, &multi) {
+		for _, e := range multi.AllErrors() {
+			collectViolations(violations, prefix, e)
+		}
+		return
+	}
+	var field fieldError
+	if !errors.As(err, &field) {
+		violations[strings.TrimSuffix(prefix, ".")] = err.Error()
+		return
+	}
+	path := prefix + fieldPath(field.Field())
+	// An embedded message reports the violations of its own fields as the cause
+	if cause := field.Cause(); cause != nil {
+		var nested fieldError
+		if errors.As(cause, &nested) || errors.As(cause, &multi) {
+			collectViolations(violations, path+".", cause)
+			return
+		}
+	}
+	violations[path] = field.Reason()
+}
+
+// fieldPath converts the Go field name reported by the validator, such as `SouthWest` or `Points[2]`,
+// into the name of the field in the protocol buffers, namely `south_west` or `points[2]`.
+func fieldPath(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ignoreUnmasked drops the violations of the fields of the message below the prefix that the paths of the field
+// mask do not name. An empty mask, like the wildcard `*`, names all the fields.
+func ignoreUnmasked(violations map[string]string, prefix string, paths []string) {
+	if len(paths) == 0 || slices.Contains(paths, "*") {
+		return
+	}
+	for path := range violations {
+		field, ok := strings.CutPrefix(path, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexAny(field, ".["); i >= 0 {
+			field = field[:i]
+		}
+		if !slices.Contains(paths, field) {
+			delete(violations, path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+	"strconv"
+
+	"github.com/go-kratos/kratos/v2/errors"
+)
+
+// BatchCreateProjects creates the projects in parent order, either all at once or one by one.
+func (s *ProjectService) BatchCreateProjects(ctx context.Context, req *v1.BatchCreateProjectsRequest) (*v1.BatchCreateProjectsResponse, error) {
+	results, err := s.mgr.BatchAdd(ctx, req.Projects, req.Atomic)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.BatchCreateProjectsResponse{Results: make([]*v1.BatchResult, 0, len(results))}
+	for i, result := range results {
+		resp.Results = append(resp.Results, newBatchResult(i, req.Projects[i].ProjectId, result))
+	}
+	return resp, nil
+}
+
+// BatchUpdateProjects applies the updates in order, either all at once or one by one.
+//
+// Like a request breaking the validation rules, an update designating two different projects is malformed and
+// rejects the whole batch.
+func (s *ProjectService) BatchUpdateProjects(ctx context.Context, req *v1.BatchUpdateProjectsRequest) (*v1.BatchUpdateProjectsResponse, error) {
+	updates := make([]biz.ProjectUpdate, 0, len(req.Requests))
+	for i, r := range req.Requests {
+		update, err := toProjectUpdate(r)
+		if err != nil {
+			return nil, errors.FromError(err).WithMetadata(map[string]string{"index": strconv.Itoa(i)})
+		}
+		updates = append(updates, update)
+	}
+	results, err := s.mgr.BatchUpdate(ctx, updates, req.Atomic)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.BatchUpdateProjectsResponse{Results: make([]*v1.BatchResult, 0, len(results))}
+	for i, result := range results {
+		resp.Results = append(resp.Results, newBatchResult(i, req.Requests[i].ProjectId, result))
+	}
+	return resp, nil
+}
+
+// BatchDeleteProjects applies the deletions in order, either all at once or one by one.
+func (s *ProjectService) BatchDeleteProjects(ctx context.Context, req *v1.BatchDeleteProjectsRequest) (*v1.BatchDeleteProjectsResponse, error) {
+	deletions := make([]biz.ProjectDeletion, 0, len(req.Requests))
+	for _, r := range req.Requests {
+		deletions = append(deletions, biz.ProjectDeletion{ProjectId: r.ProjectId, Policy: r.Policy, Etag: r.Etag})
+	}
+	results, err := s.mgr.BatchRemove(ctx, deletions, req.Atomic)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.BatchDeleteProjectsResponse{Results: make([]*v1.BatchResult, 0, len(results))}
+	for i, result := range results {
+		resp.Results = append(resp.Results, newBatchResult(i, req.Requests[i].ProjectId, result))
+	}
+	return resp, nil
+}
+
+// newBatchResult reports the outcome of the item at the index of a batch.
+func newBatchResult(index int, projectId string, result biz.BatchResult) *v1.BatchResult {
+	r := &v1.BatchResult{
+		Index:     int32(index),
+		ProjectId: projectId,
+		Success:   result.Err == nil,
+		Etag:      result.Etag,
+	}
+	if result.Err != nil {
+		e := errors.FromError(result.Err)
+		r.Reason = e.Reason
+		r.Message = e.Message
+	}
+	return r
+}
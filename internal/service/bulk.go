@@ -0,0 +1,111 @@
+package service
+
+import (
+	"io"
+	v1 "project/api/project/v1"
+	"project/internal/biz"
+
+	"github.com/go-kratos/kratos/v2/errors"
+)
+
+// ImportProjects imports the stream of projects sent by the caller, see [biz.ProjectManager.NewBulkImport].
+//
+// The first message opens the import under its ID, and the stream is rejected as a whole when that message is
+// malformed. Any later malformed message is reported as an error record like the projects that cannot be imported.
+// A progress record is sent whenever a chunk of projects is written, and a last one once the stream is imported.
+func (s *ProjectService) ImportProjects(stream v1.ProjectManagement_ImportProjectsServer) error {
+	ctx := stream.Context()
+	var imp *biz.BulkImport
+	var importId string
+	for index := int64(0); ; index++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// The validation middleware only sees the opening of the stream, not the messages
+		var invalid error
+		if err = req.ValidateAll(); err != nil {
+			invalid = v1.ErrorMalformedInput("Malformed request: %v", err)
+		} else if req.Project.ProjectId == "" {
+			// Generated IDs would differ between the runs of an import, which could then not be resumed
+			invalid = v1.ErrorMalformedInput("The ID of an imported project is required")
+		}
+		if imp == nil {
+			if invalid != nil {
+				return invalid
+			}
+			if imp, err = s.mgr.NewBulkImport(ctx, req.ImportId); err != nil {
+				return err
+			}
+			importId = req.ImportId
+		}
+		if invalid == nil && req.ImportId != "" && req.ImportId != importId {
+			invalid = v1.ErrorMalformedInput("The import %v cannot carry on with the import ID %v", importId, req.ImportId)
+		}
+		if invalid != nil {
+			if err = sendImportFailures(stream, imp.Reject(index, req.GetProject().GetProjectId(), invalid)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		flushed, failures, err := imp.Add(ctx, index, req.Project)
+		if err != nil {
+			return err
+		}
+		if err = sendImportFailures(stream, failures...); err != nil {
+			return err
+		}
+		if flushed {
+			if err = stream.Send(newImportProgress(importId, imp.Progress(), false)); err != nil {
+				return err
+			}
+		}
+	}
+	// Nothing was imported from an empty stream
+	if imp == nil {
+		return nil
+	}
+
+	failures, err := imp.Close(ctx)
+	if serr := sendImportFailures(stream, failures...); serr != nil {
+		return serr
+	}
+	if err != nil {
+		return err
+	}
+	return stream.Send(newImportProgress(importId, imp.Progress(), true))
+}
+
+// sendImportFailures streams an error record for every project that could not be imported.
+func sendImportFailures(stream v1.ProjectManagement_ImportProjectsServer, failures ...biz.ImportFailure) error {
+	for _, f := range failures {
+		e := errors.FromError(f.Err)
+		if err := stream.Send(&v1.ImportProjectsResponse{Event: &v1.ImportProjectsResponse_Error{Error: &v1.ImportError{
+			Index:     f.Index,
+			ProjectId: f.ProjectId,
+			Reason:    e.Reason,
+			Message:   e.Message,
+		}}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newImportProgress reports the progress of the import, done being set for the last report.
+func newImportProgress(importId string, p biz.ImportProgress, done bool) *v1.ImportProjectsResponse {
+	return &v1.ImportProjectsResponse{Event: &v1.ImportProjectsResponse_Progress{Progress: &v1.ImportProgress{
+		ImportId: importId,
+		Received: p.Received,
+		Created:  p.Created,
+		Updated:  p.Updated,
+		Skipped:  p.Skipped,
+		Failed:   p.Failed,
+		Waiting:  p.Waiting,
+		Done:     done,
+	}}}
+}
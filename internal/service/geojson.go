@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	v1 "project/api/project/v1"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+)
+
+// The GeoJSON objects (RFC 7946) exchanged with GIS tools. Every feature describes one project: its geometry is
+// the coordinate of the project, together with the boundary when there is one, and the other fields of the
+// project are the properties of the feature.
+type (
+	featureCollection struct {
+		Type     string     `json:"type"`
+		Features []*feature `json:"features"`
+	}
+
+	feature struct {
+		Type       string             `json:"type"`
+		ID         string             `json:"id,omitempty"`
+		Geometry   *geometry          `json:"geometry"`
+		Properties *featureProperties `json:"properties"`
+	}
+
+	geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates,omitempty"`
+		Geometries  []*geometry     `json:"geometries,omitempty"`
+	}
+
+	featureProperties struct {
+		ProjectID    string `json:"project_id"`
+		ParentProjID string `json:"parent_proj_id"`
+		Desc         string `json:"desc"`
+		Location     string `json:"location"`
+		Depth        int32  `json:"depth"`
+		CreateTime   string `json:"create_time,omitempty"`
+		LastUpdate   string `json:"last_update,omitempty"`
+	}
+)
+
+// GeoJSON type names
+const (
+	geoJSONFeatureCollection  = "FeatureCollection"
+	geoJSONFeature            = "Feature"
+	geoJSONPoint              = "Point"
+	geoJSONPolygon            = "Polygon"
+	geoJSONGeometryCollection = "GeometryCollection"
+)
+
+// ExportProjectsGeoJSON exports the projects selected by one of the queries as a GeoJSON FeatureCollection.
+func (s *ProjectService) ExportProjectsGeoJSON(ctx context.Context, req *v1.ExportProjectsGeoJSONRequest) (*v1.GeoJSONDocument, error) {
+	var projects []*v1.Project
+	var err error
+	switch source := req.Source.(type) {
+	case *v1.ExportProjectsGeoJSONRequest_Subtree:
+		_, projects, err = s.mgr.GetProjectSubtree(ctx, source.Subtree.ProjectId, source.Subtree.MaxDepth)
+	case *v1.ExportProjectsGeoJSONRequest_Nearby:
+		var results []*v1.NearbyProject
+		results, err = s.mgr.FindNearbyProjects(ctx, source.Nearby.CurrentLocation, source.Nearby.Radius)
+		projects = nearbyToProjects(results)
+	case *v1.ExportProjectsGeoJSONRequest_Nearest:
+		var results []*v1.NearbyProject
+		results, err = s.mgr.FindNearestProjects(ctx, source.Nearest.Location, source.Nearest.K, source.Nearest.SubtreeRootId)
+		projects = nearbyToProjects(results)
+	case *v1.ExportProjectsGeoJSONRequest_Bounds:
+		projects, err = s.mgr.FindProjectsInBounds(ctx, source.Bounds.SouthWest, source.Bounds.NorthEast, source.Bounds.SubtreeRootId)
+	case *v1.ExportProjectsGeoJSONRequest_Polygon:
+		projects, err = s.mgr.FindProjectsInPolygon(ctx, source.Polygon.Polygon, source.Polygon.SubtreeRootId)
+	case *v1.ExportProjectsGeoJSONRequest_Containing:
+		projects, err = s.mgr.FindProjectsContainingPoint(ctx, source.Containing.Location, source.Containing.SubtreeRootId)
+	default:
+		return nil, v1.ErrorMalformedInput("The projects to export should be selected by one of the queries")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	collection := &featureCollection{Type: geoJSONFeatureCollection, Features: make([]*feature, 0, len(projects))}
+	for _, p := range projects {
+		collection.Features = append(collection.Features, projectToFeature(p))
+	}
+	content, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.GeoJSONDocument{Content: content}, nil
+}
+
+// ImportProjectsGeoJSON creates or updates the projects described by the features of a GeoJSON FeatureCollection.
+//
+// A malformed collection is rejected as a whole, while every feature that cannot be imported is reported
+// separately without preventing the other features from being imported.
+func (s *ProjectService) ImportProjectsGeoJSON(ctx context.Context, req *v1.ImportProjectsGeoJSONRequest) (*v1.ImportProjectsGeoJSONResponse, error) {
+	var collection featureCollection
+	if err := json.Unmarshal(req.Content, &collection); err != nil {
+		return nil, v1.ErrorMalformedInput("Malformed GeoJSON document: %v", err)
+	}
+	if collection.Type != geoJSONFeatureCollection {
+		return nil, v1.ErrorMalformedInput("Expecting a GeoJSON %v, got %q", geoJSONFeatureCollection, collection.Type)
+	}
+
+	resp := &v1.ImportProjectsGeoJSONResponse{}
+	// Features that cannot be converted are reported right away, the others are imported together
+	var projects []*v1.Project
+	var indexes []int
+	for i, f := range collection.Features {
+		p, err := featureToProject(f)
+		if err != nil {
+			resp.Errors = append(resp.Errors, newFeatureError(i, p, err))
+			continue
+		}
+		projects = append(projects, p)
+		indexes = append(indexes, i)
+	}
+
+	for i, result := range s.mgr.Import(ctx, projects) {
+		switch {
+		case result.Err != nil:
+			resp.Errors = append(resp.Errors, newFeatureError(indexes[i], projects[i], result.Err))
+		case result.Created:
+			resp.Created++
+		default:
+			resp.Updated++
+		}
+	}
+	return resp, nil
+}
+
+// newFeatureError reports why the feature at the index could not be imported.
+func newFeatureError(index int, p *v1.Project, err error) *v1.FeatureError {
+	e := errors.FromError(err)
+	return &v1.FeatureError{
+		Index:     int32(index),
+		ProjectId: p.GetProjectId(),
+		Reason:    e.Reason,
+		Message:   e.Message,
+	}
+}
+
+// nearbyToProjects strips the distances from the results of a nearby query.
+func nearbyToProjects(results []*v1.NearbyProject) []*v1.Project {
+	projects := make([]*v1.Project, 0, len(results))
+	for _, result := range results {
+		projects = append(projects, result.Project)
+	}
+	return projects
+}
+
+// projectToFeature converts a project into a GeoJSON feature.
+func projectToFeature(p *v1.Project) *feature {
+	f := &feature{
+		Type: geoJSONFeature,
+		ID:   p.ProjectId,
+		Properties: &featureProperties{
+			ProjectID:    p.ProjectId,
+			ParentProjID: p.ParentProjId,
+			Desc:         p.Desc,
+			Location:     p.Location,
+			Depth:        p.Depth,
+		},
+	}
+	if p.CreateTime != nil {
+		f.Properties.CreateTime = p.CreateTime.AsTime().Format(time.RFC3339)
+	}
+	if p.LastUpdate != nil {
+		f.Properties.LastUpdate = p.LastUpdate.AsTime().Format(time.RFC3339)
+	}
+
+	var geometries []*geometry
+	if p.Coordinate != nil {
+		coordinates, _ := json.Marshal(positionOf(p.Coordinate))
+		geometries = append(geometries, &geometry{Type: geoJSONPoint, Coordinates: coordinates})
+	}
+	if p.Boundary != nil {
+		ring := make([][2]float64, 0, len(p.Boundary.Points)+1)
+		for _, point := range p.Boundary.Points {
+			ring = append(ring, positionOf(point))
+		}
+		// GeoJSON rings repeat their first position at the end
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			ring = append(ring, ring[0])
+		}
+		coordinates, _ := json.Marshal([][][2]float64{ring})
+		geometries = append(geometries, &geometry{Type: geoJSONPolygon, Coordinates: coordinates})
+	}
+	switch len(geometries) {
+	case 1:
+		f.Geometry = geometries[0]
+	case 2:
+		f.Geometry = &geometry{Type: geoJSONGeometryCollection, Geometries: geometries}
+	}
+	return f
+}
+
+// featureToProject converts a GeoJSON feature into a project. The ID of the feature stands for the project ID
+// when the properties omit it, and a polygon geometry becomes the boundary of the project. The project then has to
+// follow the same rules as the projects of the requests.
+func featureToProject(f *feature) (*v1.Project, error) {
+	if f == nil || f.Type != geoJSONFeature {
+		return nil, v1.ErrorMalformedInput("Expecting a GeoJSON %v", geoJSONFeature)
+	}
+	p := &v1.Project{ProjectId: f.ID}
+	if props := f.Properties; props != nil {
+		if props.ProjectID != "" {
+			p.ProjectId = props.ProjectID
+		}
+		p.ParentProjId = props.ParentProjID
+		p.Desc = props.Desc
+		p.Location = props.Location
+	}
+	if p.ProjectId == "" {
+		return p, v1.ErrorMalformedInput("The feature does not carry a project ID")
+	}
+	if f.Geometry == nil {
+		return p, v1.ErrorMalformedInput("The feature does not carry a geometry")
+	}
+
+	geometries := []*geometry{f.Geometry}
+	if f.Geometry.Type == geoJSONGeometryCollection {
+		geometries = f.Geometry.Geometries
+	}
+	for _, g := range geometries {
+		// Unlike the geometry of a feature, the members of a collection cannot be null
+		if g == nil {
+			return p, v1.ErrorMalformedInput("The geometry collection holds a null geometry")
+		}
+		switch g.Type {
+		case geoJSONPoint:
+			var position [2]float64
+			if err := json.Unmarshal(g.Coordinates, &position); err != nil {
+				return p, v1.ErrorMalformedInput("Malformed point: %v", err)
+			}
+			p.Coordinate = pointOf(position)
+		case geoJSONPolygon:
+			var rings [][][2]float64
+			if err := json.Unmarshal(g.Coordinates, &rings); err != nil || len(rings) == 0 {
+				return p, v1.ErrorMalformedInput("Malformed polygon: %v", err)
+			}
+			p.Boundary = &v1.GeoPolygon{}
+			for _, position := range rings[0] {
+				p.Boundary.Points = append(p.Boundary.Points, pointOf(position))
+			}
+		default:
+			return p, v1.ErrorMalformedInput("Unsupported geometry type %q", g.Type)
+		}
+	}
+	if p.Coordinate == nil {
+		return p, v1.ErrorMalformedInput("The feature does not carry a point for the project coordinate")
+	}
+	// The features skip the validation of the requests, while their IDs end up in the paths of the projects
+	if err := p.ValidateAll(); err != nil {
+		return p, v1.ErrorMalformedInput("Malformed feature: %v", err)
+	}
+	return p, nil
+}
+
+// positionOf returns the GeoJSON position of a point, longitude first.
+func positionOf(point *v1.GeoPoint) [2]float64 {
+	return [2]float64{point.Longitude, point.Latitude}
+}
+
+// pointOf returns the point at a GeoJSON position.
+func pointOf(position [2]float64) *v1.GeoPoint {
+	return &v1.GeoPoint{Longitude: position[0], Latitude: position[1]}
+}
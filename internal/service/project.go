@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
-	"google.golang.org/protobuf/types/known/emptypb"
 	v1 "project/api/project/v1"
 	"project/internal/biz"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ProjectService is the service interface for other services or users to call.
@@ -21,70 +22,290 @@ func NewProjectService(mgr *biz.ProjectManager) *ProjectService {
 	return &ProjectService{mgr: mgr}
 }
 
-func (s *ProjectService) AddProject(ctx context.Context, proj *v1.Project) (empty *emptypb.Empty, err error) {
-	// Validate the project input before adding
-	//if valid := proj.Validate(); valid != nil {
-	//	return nil, v1.ErrorMalformedInput("Malformed project information: %v", valid)
-	//}
-	err = s.mgr.Add(ctx, proj)
+func (s *ProjectService) CreateProject(ctx context.Context, req *v1.CreateProjectRequest) (*v1.CreateProjectResponse, error) {
+	if err := s.mgr.Add(ctx, req.Project); err != nil {
+		return nil, err
+	}
+	return &v1.CreateProjectResponse{ProjectId: req.Project.ProjectId}, nil
+}
+
+func (s *ProjectService) GetProject(ctx context.Context, req *v1.GetProjectRequest) (*v1.Project, error) {
+	if req.AsOf != nil {
+		return s.mgr.GetAsOf(ctx, req.ProjectId, req.AsOf.AsTime())
+	}
+	return s.mgr.GetById(ctx, req.ProjectId)
+}
+
+func (s *ProjectService) UpdateProject(ctx context.Context, req *v1.UpdateProjectRequest) (*v1.UpdateProjectResponse, error) {
+	update, err := toProjectUpdate(req)
 	if err != nil {
 		return nil, err
 	}
-	return &emptypb.Empty{}, nil
+	project, err := s.mgr.Update(ctx, update.Project, update.Mask)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.UpdateProjectResponse{Success: true, Etag: project.Etag}, nil
+}
+
+// toProjectUpdate checks that the update request designates a single project, and returns the update it asks for.
+func toProjectUpdate(req *v1.UpdateProjectRequest) (biz.ProjectUpdate, error) {
+	// The project is identified by the request, the ID carried by the project cannot designate another one.
+	// A partial update may leave it out.
+	if req.Project.ProjectId == "" {
+		req.Project.ProjectId = req.ProjectId
+	}
+	if req.Project.ProjectId != req.ProjectId {
+		return biz.ProjectUpdate{}, v1.ErrorMalformedInput("The project ID %v does not match the requested project %v", req.Project.ProjectId, req.ProjectId)
+	}
+	// The entity tag of the project is output only, the caller states the one it expects in the request
+	req.Project.Etag = req.Etag
+	return biz.ProjectUpdate{Project: req.Project, Mask: req.UpdateMask.GetPaths()}, nil
 }
 
-func (s *ProjectService) UpdateProject(ctx context.Context, proj *v1.Project) (empty *emptypb.Empty, err error) {
-	// Validate the project input before updating
-	//if valid := proj.Validate(); valid != nil {
-	//	return nil, v1.ErrorMalformedInput("Malformed project information: %v", valid)
-	//}
-	err = s.mgr.Update(ctx, proj)
+func (s *ProjectService) DeleteProject(ctx context.Context, req *v1.DeleteProjectRequest) (*v1.DeleteProjectResponse, error) {
+	if err := s.mgr.RemoveById(ctx, req.ProjectId, req.Policy, req.Etag); err != nil {
+		return nil, err
+	}
+	return &v1.DeleteProjectResponse{Success: true}, nil
+}
+
+func (s *ProjectService) SearchBranchProjects(ctx context.Context, req *v1.SearchBranchProjectsRequest) (*v1.SearchBranchProjectsResponse, error) {
+	projects, err := s.mgr.GetProjectPath(ctx, req.ParentProjId)
 	if err != nil {
 		return nil, err
 	}
-	return &emptypb.Empty{}, nil
+	return &v1.SearchBranchProjectsResponse{BranchProjects: projects}, nil
 }
 
-func (s *ProjectService) FindProjectByName(ctx context.Context, name *v1.ProjectName) (proj *v1.Project, err error) {
-	// Validate the project name input before searching
-	//if valid := name.Validate(); valid != nil {
-	//	return nil, v1.ErrorMalformedInput("Malformed project name: %v", valid)
-	//}
-	return s.mgr.GetByName(ctx, name.Name)
+func (s *ProjectService) FindNearbyProjects(ctx context.Context, req *v1.FindNearbyProjectsRequest) (*v1.FindNearbyProjectsResponse, error) {
+	results, err := s.mgr.FindNearbyProjects(ctx, req.CurrentLocation, req.Radius)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]*v1.Project, 0, len(results))
+	for _, result := range results {
+		projects = append(projects, result.Project)
+	}
+	return &v1.FindNearbyProjectsResponse{
+		NearbyProjects: projects,
+		Results:        results,
+	}, nil
 }
 
-func (s *ProjectService) FindProjectById(ctx context.Context, pid *v1.ProjectId) (proj *v1.Project, err error) {
-	// Validate the project ID input before searching
-	//if valid := pid.Validate(); valid != nil {
-	//	return nil, v1.ErrorMalformedInput("Malformed project ID: %v", valid)
-	//}
-	return s.mgr.GetById(ctx, pid.Id)
+func (s *ProjectService) GetProjectSubtree(ctx context.Context, req *v1.GetProjectSubtreeRequest) (*v1.GetProjectSubtreeResponse, error) {
+	root, projects, err := s.mgr.GetProjectSubtree(ctx, req.ProjectId, req.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Flat {
+		return &v1.GetProjectSubtreeResponse{Projects: projects}, nil
+	}
+	return &v1.GetProjectSubtreeResponse{Root: root}, nil
+}
+
+func (s *ProjectService) MoveProject(ctx context.Context, req *v1.MoveProjectRequest) (*v1.MoveProjectResponse, error) {
+	if err := s.mgr.Move(ctx, req.ProjectId, req.NewParentProjId); err != nil {
+		return nil, err
+	}
+	return &v1.MoveProjectResponse{Success: true}, nil
 }
 
-func (s *ProjectService) RemoveProjectById(ctx context.Context, pid *v1.ProjectId) (empty *emptypb.Empty, err error) {
-	err = s.mgr.RemoveById(ctx, pid.Id)
+func (s *ProjectService) FindNearestProjects(ctx context.Context, req *v1.FindNearestProjectsRequest) (*v1.FindNearestProjectsResponse, error) {
+	results, err := s.mgr.FindNearestProjects(ctx, req.Location, req.K, req.SubtreeRootId)
 	if err != nil {
 		return nil, err
 	}
-	return &emptypb.Empty{}, nil
+	return &v1.FindNearestProjectsResponse{Results: results}, nil
 }
 
-func (s *ProjectService) SearchBranchProjects(ctx context.Context, id *v1.ProjectId) ([]*v1.Project, error) {
-	projects, err := s.mgr.GetProjectPath(ctx, id.Id)
+func (s *ProjectService) FindProjectsInBounds(ctx context.Context, req *v1.FindProjectsInBoundsRequest) (*v1.FindProjectsInBoundsResponse, error) {
+	projects, err := s.mgr.FindProjectsInBounds(ctx, req.SouthWest, req.NorthEast, req.SubtreeRootId)
 	if err != nil {
 		return nil, err
 	}
+	return &v1.FindProjectsInBoundsResponse{Projects: projects}, nil
+}
 
-	return projects, nil
+func (s *ProjectService) FindProjectsInPolygon(ctx context.Context, req *v1.FindProjectsInPolygonRequest) (*v1.FindProjectsInPolygonResponse, error) {
+	projects, err := s.mgr.FindProjectsInPolygon(ctx, req.Polygon, req.SubtreeRootId)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.FindProjectsInPolygonResponse{Projects: projects}, nil
+}
 
+func (s *ProjectService) FindProjectsContainingPoint(ctx context.Context, req *v1.FindProjectsContainingPointRequest) (*v1.FindProjectsContainingPointResponse, error) {
+	projects, err := s.mgr.FindProjectsContainingPoint(ctx, req.Location, req.SubtreeRootId)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.FindProjectsContainingPointResponse{Projects: projects}, nil
 }
-func (s *ProjectService) FindNearbyProjects(ctx context.Context, req *v1.FindNearbyProjectsRequest) (*v1.FindNearbyProjectsResponse, error) {
-	projects, err := s.mgr.FindNearbyProjects(ctx, req.CurrentLocation, req.Radius)
+
+func (s *ProjectService) ListProjects(ctx context.Context, req *v1.ListProjectsRequest) (*v1.ListProjectsResponse, error) {
+	projects, nextPageToken, err := s.mgr.ListProjects(ctx, toListProjectsFilter(req), req.PageSize, req.PageToken)
 	if err != nil {
 		return nil, err
 	}
+	return &v1.ListProjectsResponse{Projects: projects, NextPageToken: nextPageToken}, nil
+}
 
-	return &v1.FindNearbyProjectsResponse{
-		NearbyProjects: projects,
-	}, nil
+// listFilterRequest is implemented by the requests carrying the filters of the project listing.
+type listFilterRequest interface {
+	GetParentProjId() string
+	GetLocationContains() string
+	GetCreateTimeAfter() *timestamppb.Timestamp
+	GetCreateTimeBefore() *timestamppb.Timestamp
+	GetUpdateTimeAfter() *timestamppb.Timestamp
+	GetUpdateTimeBefore() *timestamppb.Timestamp
+	GetDeleted() v1.DeletedFilter
+	GetOrderBy() v1.ListOrder
+	GetDescending() bool
+}
+
+// toListProjectsFilter returns the filter of the project listing carried by the request.
+func toListProjectsFilter(req listFilterRequest) *biz.ListProjectsFilter {
+	filter := &biz.ListProjectsFilter{
+		ParentProjId:     req.GetParentProjId(),
+		LocationContains: req.GetLocationContains(),
+		Deleted:          req.GetDeleted(),
+		OrderBy:          req.GetOrderBy(),
+		Descending:       req.GetDescending(),
+	}
+	// Unset timestamps stay as zero times, which leaves the corresponding bounds out
+	if t := req.GetCreateTimeAfter(); t != nil {
+		filter.CreateAfter = t.AsTime()
+	}
+	if t := req.GetCreateTimeBefore(); t != nil {
+		filter.CreateBefore = t.AsTime()
+	}
+	if t := req.GetUpdateTimeAfter(); t != nil {
+		filter.UpdateAfter = t.AsTime()
+	}
+	if t := req.GetUpdateTimeBefore(); t != nil {
+		filter.UpdateBefore = t.AsTime()
+	}
+	return filter
+}
+
+// ExportProjects streams the projects matching the filters of the request, together with their paths.
+func (s *ProjectService) ExportProjects(req *v1.ExportProjectsRequest, stream v1.ProjectManagement_ExportProjectsServer) error {
+	// The validation middleware only sees the opening of the stream, not its request
+	if err := req.ValidateAll(); err != nil {
+		return v1.ErrorMalformedInput("Malformed request: %v", err)
+	}
+	return s.ExportProjectRows(stream.Context(), req, stream.Send)
+}
+
+// ExportProjectRows calls emit for every project matching the filters of the request, one project at a time.
+// It serves both the gRPC stream and the HTTP downloads.
+func (s *ProjectService) ExportProjectRows(ctx context.Context, req *v1.ExportProjectsRequest, emit func(*v1.ExportedProject) error) error {
+	filter := toListProjectsFilter(req)
+	filter.SubtreeRootId = req.SubtreeRootId
+	filter.MaxDepth = req.MaxDepth
+	return s.mgr.Export(ctx, filter, emit)
+}
+
+func (s *ProjectService) ListDeletedProjects(ctx context.Context, req *v1.ListDeletedProjectsRequest) (*v1.ListDeletedProjectsResponse, error) {
+	projects, nextPageToken, err := s.mgr.ListDeletedProjects(ctx, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListDeletedProjectsResponse{Projects: projects, NextPageToken: nextPageToken}, nil
+}
+
+func (s *ProjectService) RestoreProject(ctx context.Context, req *v1.RestoreProjectRequest) (*v1.RestoreProjectResponse, error) {
+	if err := s.mgr.RecoverById(ctx, req.ProjectId); err != nil {
+		return nil, err
+	}
+	return &v1.RestoreProjectResponse{Success: true}, nil
+}
+
+func (s *ProjectService) PurgeProject(ctx context.Context, req *v1.PurgeProjectRequest) (*v1.PurgeProjectResponse, error) {
+	if err := s.mgr.Purge(ctx, req.ProjectId); err != nil {
+		return nil, err
+	}
+	return &v1.PurgeProjectResponse{Success: true}, nil
+}
+
+func (s *ProjectService) RebuildProjectFilter(ctx context.Context, _ *v1.RebuildProjectFilterRequest) (*v1.RebuildProjectFilterResponse, error) {
+	items, err := s.mgr.RebuildProjectFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.RebuildProjectFilterResponse{Items: int64(items)}, nil
+}
+
+func (s *ProjectService) GrantRole(ctx context.Context, req *v1.GrantRoleRequest) (*v1.Membership, error) {
+	return s.mgr.GrantRole(ctx, &biz.Membership{
+		PrincipalType: req.PrincipalType,
+		PrincipalId:   req.PrincipalId,
+		ProjectId:     req.ProjectId,
+		Role:          req.Role,
+	})
+}
+
+func (s *ProjectService) RevokeRole(ctx context.Context, req *v1.RevokeRoleRequest) (*v1.RevokeRoleResponse, error) {
+	principal := biz.Principal{Type: req.PrincipalType, Id: req.PrincipalId}
+	if err := s.mgr.RevokeRole(ctx, req.ProjectId, principal); err != nil {
+		return nil, err
+	}
+	return &v1.RevokeRoleResponse{Success: true}, nil
+}
+
+func (s *ProjectService) ListEffectivePermissions(ctx context.Context, req *v1.ListEffectivePermissionsRequest) (*v1.ListEffectivePermissionsResponse, error) {
+	// The principal only filters the roles when it is fully specified
+	var principal *biz.Principal
+	if req.PrincipalType != v1.PrincipalType_PRINCIPAL_TYPE_UNSPECIFIED && req.PrincipalId != "" {
+		principal = &biz.Principal{Type: req.PrincipalType, Id: req.PrincipalId}
+	} else if req.PrincipalType != v1.PrincipalType_PRINCIPAL_TYPE_UNSPECIFIED || req.PrincipalId != "" {
+		return nil, v1.ErrorMalformedInput("The principal type and ID should be given together")
+	}
+	permissions, err := s.mgr.ListEffectivePermissions(ctx, req.ProjectId, principal)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListEffectivePermissionsResponse{Permissions: permissions}, nil
+}
+
+func (s *ProjectService) ListAuditEvents(ctx context.Context, req *v1.ListAuditEventsRequest) (*v1.ListAuditEventsResponse, error) {
+	filter := &biz.AuditFilter{
+		ProjectId:      req.ProjectId,
+		IncludeSubtree: req.IncludeSubtree,
+		Actor:          req.Actor,
+	}
+	if req.StartTime != nil {
+		filter.StartTime = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		filter.EndTime = req.EndTime.AsTime()
+	}
+	events, nextPageToken, err := s.mgr.ListAuditEvents(ctx, filter, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListAuditEventsResponse{Events: events, NextPageToken: nextPageToken}, nil
+}
+
+func (s *ProjectService) ListProjectRevisions(ctx context.Context, req *v1.ListProjectRevisionsRequest) (*v1.ListProjectRevisionsResponse, error) {
+	revisions, nextPageToken, err := s.mgr.ListRevisions(ctx, req.ProjectId, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListProjectRevisionsResponse{Revisions: revisions, NextPageToken: nextPageToken}, nil
+}
+
+func (s *ProjectService) GetProjectRevision(ctx context.Context, req *v1.GetProjectRevisionRequest) (*v1.ProjectRevision, error) {
+	return s.mgr.GetRevision(ctx, req.ProjectId, req.Revision)
+}
+
+func (s *ProjectService) RevertProject(ctx context.Context, req *v1.RevertProjectRequest) (*v1.RevertProjectResponse, error) {
+	project, revision, err := s.mgr.Revert(ctx, req.ProjectId, req.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.RevertProjectResponse{Project: project, Revision: revision}, nil
 }
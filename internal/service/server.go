@@ -7,7 +7,7 @@ import (
 )
 
 type ServerService struct {
-	pb.UnimplementedProjectServer
+	pb.UnimplementedServerServer
 }
 
 func NewServerService() *ServerService {